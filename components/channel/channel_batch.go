@@ -0,0 +1,122 @@
+package channel
+
+import "time"
+
+// pump
+// Forwards the data units of the input to the returned go channel, closing it once the input is
+// done. Pull can not be interrupted, so done is only observed between data units. Panics with
+// ErrSequenced if the input is Sequenced, as the data units would be pulled on another goroutine.
+func pump(input InputChannel, done <-chan struct{}) <-chan Message {
+	if sequenced, ok := input.(Sequenced); ok && sequenced.Sequenced() {
+		panic(ErrSequenced)
+	}
+
+	items := make(chan Message)
+
+	go func() {
+		defer close(items)
+
+		for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+			select {
+			case items <- data:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return items
+}
+
+// NewBatchReader
+// A size of zero only flushes batches on the interval and an interval of zero only flushes
+// batches once they are full. The interval starts when the first data unit enters a batch.
+// Without either a batch would grow until the input is done, so DefaultBatchSize is used.
+// An input that is Sequenced can not be batched.
+func NewBatchReader(input InputChannel, size int, interval time.Duration) *BatchReader {
+	reader := new(BatchReader)
+
+	if (size <= 0) && (interval <= 0) {
+		size = DefaultBatchSize
+	}
+
+	reader.input = input
+	reader.size = size
+	reader.interval = interval
+	reader.output = make(chan Batch)
+	reader.done = make(chan struct{})
+
+	go reader.run(pump(input, reader.done))
+
+	return reader
+}
+
+func (reader *BatchReader) run(items <-chan Message) {
+	defer close(reader.output)
+
+	batch := make(Batch, 0)
+	var timer *time.Timer
+	var expired <-chan time.Time
+
+	flush := func() bool {
+		if timer != nil {
+			timer.Stop()
+			timer, expired = nil, nil
+		}
+		if len(batch) == 0 {
+			return true
+		}
+
+		select {
+		case reader.output <- batch:
+			batch = make(Batch, 0)
+			return true
+		case <-reader.done:
+			return false
+		}
+	}
+
+	for {
+		select {
+		case data, ok := <-items:
+			if !ok {
+				flush() // the input closed, hand over whatever is left
+				return
+			}
+
+			batch = append(batch, data)
+			if (len(batch) == 1) && (reader.interval > 0) {
+				timer = time.NewTimer(reader.interval)
+				expired = timer.C
+			}
+			if (reader.size > 0) && (len(batch) >= reader.size) && !flush() {
+				return
+			}
+		case <-expired:
+			timer, expired = nil, nil
+			if !flush() {
+				return
+			}
+		case <-reader.done:
+			return
+		}
+	}
+}
+
+// Next blocks until a batch is ready, ok is false once the input is done and every batch was returned
+func (reader *BatchReader) Next() (batch Batch, ok bool) {
+	batch, ok = <-reader.output
+	return batch, ok
+}
+
+// Pull lets the reader be used as an InputChannel, where every data unit is a Batch
+func (reader *BatchReader) Pull() (data Message, ok bool) {
+	return reader.Next()
+}
+
+// Close stops the reader when the stage returns before the input is done
+func (reader *BatchReader) Close() {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+}
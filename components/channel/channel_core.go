@@ -1,45 +1,244 @@
 package channel
 
-func NewManagedChannel(threshold, growth int) *ManagedChannel {
+import (
+	"sync"
+	"time"
+)
+
+func NewManagedChannel(threshold, growth int, capacity ...int) *ManagedChannel {
 	mc := new(ManagedChannel)
 
 	mc.Config.Threshold = threshold
 	mc.Config.GrowthFactor = growth
-	mc.Channel = make(chan Message)
+	mc.Config.Capacity = DefaultChannelCapacity
+	if (len(capacity) == 1) && (capacity[0] > 0) {
+		mc.Config.Capacity = capacity[0]
+	}
+
+	// a channel that can never hold more units than the threshold would never be
+	// considered congested, the autoscaler relies on seeing the threshold crossed
+	if mc.Config.Capacity <= threshold {
+		mc.Config.Capacity = threshold + 1
+	}
+
+	mc.channel = make(chan Message, mc.Config.Capacity)
+	mc.cancelled = make(chan struct{})
+	mc.empty = sync.NewCond(&mc.mutex)
+	mc.State = Empty
 
 	return mc
 }
 
+// Push
+// Blocks until there is room in the channel for the data unit. If the channel has been
+// cancelled the data unit is discarded so that the producer is never left blocked.
 func (mc *ManagedChannel) Push(data Message) {
+	mc.PushUntil(data, nil)
+}
+
+// PushUntil
+// Behaves like Push, but gives up on the data unit and returns false as soon as the stop
+// channel is closed or the channel is cancelled.
+func (mc *ManagedChannel) PushUntil(data Message, stop <-chan struct{}) bool {
+	if mc.IsCancelled() {
+		return false
+	}
+
+	if envelope, ok := data.(*Envelope); ok {
+		envelope.stamp(time.Now())
+	}
+
+	select {
+	case mc.channel <- data:
+	case <-mc.cancelled:
+		return false
+	case <-stop:
+		return false
+	}
+
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 
+	mc.enqueued++
+	mc.update()
+
+	return true
+}
+
+// Offer
+// Pushes a data unit from outside the stage that produces for the channel, returns false
+// instead of panicking if the channel has already been closed or cancelled.
+func (mc *ManagedChannel) Offer(data Message) (ok bool) {
+	if mc.IsCancelled() {
+		return false
+	}
+
+	if envelope, isEnvelope := data.(*Envelope); isEnvelope {
+		envelope.stamp(time.Now())
+	}
+
+	// the producers of the channel may return and have it closed at any point
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	select {
+	case mc.channel <- data:
+	case <-mc.cancelled:
+		return false
+	}
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.enqueued++
+	mc.update()
+
+	return true
+}
+
+// Pull
+// Blocks until a data unit is available, ok is false once the channel is closed and
+// every data unit has been pulled, or the channel has been cancelled.
+func (mc *ManagedChannel) Pull() (data Message, ok bool) {
+	return mc.PullUntil(nil)
+}
+
+// PullUntil
+// Behaves like Pull, but also returns false as soon as the stop channel is closed.
+func (mc *ManagedChannel) PullUntil(stop <-chan struct{}) (data Message, ok bool) {
+	// a cancelled channel may still hold data units, they should not be handed out
+	if mc.IsCancelled() {
+		return nil, false
+	}
+
+	select {
+	case data, ok = <-mc.channel:
+		if !ok {
+			return nil, false
+		}
+	case <-mc.cancelled:
+		return nil, false
+	case <-stop:
+		return nil, false
+	}
+
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	mc.dequeued++
+	mc.update()
+
+	if envelope, isEnvelope := data.(*Envelope); isEnvelope {
+		now := time.Now()
+		mc.observe(envelope.receive(mc.Config.Name, now), envelope.Latency())
+	}
+
+	return data, true
+}
+
+// update refreshes the depth and state of the channel, the mutex must be held
+func (mc *ManagedChannel) update() {
+	depth := len(mc.channel)
+
+	mc.Config.Size = depth
+	if depth > mc.highWaterMark {
+		mc.highWaterMark = depth
+	}
+
 	// see if we are hitting a threshold and the successive function is
 	// getting overloaded with data units
-	if (mc.Config.Size + 1) >= mc.Config.Threshold {
+	if depth == 0 {
+		mc.State = Empty
+		mc.empty.Broadcast()
+	} else if depth >= mc.Config.Threshold {
 		mc.State = Congested
+	} else {
+		mc.State = Healthy
+	}
+}
+
+// observe adds the wait and latency of a pulled envelope to the metrics, the mutex must be held
+func (mc *ManagedChannel) observe(waited, latency time.Duration) {
+	mc.envelopes.count++
+	mc.envelopes.totalWait += waited
+	mc.envelopes.totalLatency += latency
+	if waited > mc.envelopes.maxWait {
+		mc.envelopes.maxWait = waited
+	}
+	if latency > mc.envelopes.maxLatency {
+		mc.envelopes.maxLatency = latency
+	}
+}
+
+// Close
+// Signals to the consumers that no more data units will be pushed, the data units already
+// in the channel can still be pulled. Only the supervisor should close a channel once
+// every producer has returned.
+func (mc *ManagedChannel) Close() {
+	mc.closeOnce.Do(func() {
+		close(mc.channel)
+	})
+}
+
+// Cancel
+// Stops the channel from blocking producers or consumers, pushed data units are discarded
+// and Pull returns immediately. Used when a supervisor is cancelled or fails.
+func (mc *ManagedChannel) Cancel() {
+	mc.stopOnce.Do(func() {
+		close(mc.cancelled)
+
+		mc.mutex.Lock()
+		mc.empty.Broadcast()
+		mc.mutex.Unlock()
+	})
+}
+
+func (mc *ManagedChannel) IsCancelled() bool {
+	select {
+	case <-mc.cancelled:
+		return true
+	default:
+		return false
 	}
-	mc.Config.Size++
-	mc.Channel <- data
+}
 
-	mc.wg.Add(1)
+// Status returns the state of the channel based on the number of data units waiting in it
+func (mc *ManagedChannel) Status() Status {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
+	return mc.State
 }
 
-func (mc *ManagedChannel) Pull() Message {
+// Metrics returns a snapshot of the instrumentation collected by the channel
+func (mc *ManagedChannel) Metrics() Metrics {
 	mc.mutex.Lock()
 	defer mc.mutex.Unlock()
 
-	holder := <-mc.Channel // block until data is pulled
-	mc.Config.Size--
-	if mc.Config.Size == 0 {
-		mc.State = Empty
+	return Metrics{
+		State:         mc.State,
+		Depth:         len(mc.channel),
+		Capacity:      mc.Config.Capacity,
+		Enqueued:      mc.enqueued,
+		Dequeued:      mc.dequeued,
+		HighWaterMark: mc.highWaterMark,
+		NumEnvelopes:  mc.envelopes.count,
+		TotalWait:     mc.envelopes.totalWait,
+		MaxWait:       mc.envelopes.maxWait,
+		TotalLatency:  mc.envelopes.totalLatency,
+		MaxLatency:    mc.envelopes.maxLatency,
 	}
-
-	mc.wg.Done()
-	return holder
 }
 
 func (mc *ManagedChannel) IfEmptyProceed() {
+	mc.mutex.Lock()
+	defer mc.mutex.Unlock()
+
 	// if the channel is empty, proceed
-	mc.wg.Wait()
+	for (len(mc.channel) != 0) && !mc.IsCancelled() {
+		mc.empty.Wait()
+	}
 }
@@ -0,0 +1,80 @@
+package channel
+
+import "time"
+
+// Wrap places the payload in a new envelope, the metadata can be filled in before it is pushed
+func Wrap(payload Message) *Envelope {
+	envelope := new(Envelope)
+
+	envelope.Payload = payload
+	envelope.Headers = make(map[string]string)
+
+	return envelope
+}
+
+// Unwrap returns the payload of a data unit and its envelope, or the data unit itself and nil if it has no envelope
+func Unwrap(data Message) (payload Message, envelope *Envelope) {
+	if envelope, ok := data.(*Envelope); ok {
+		return envelope.Payload, envelope
+	}
+	return data, nil
+}
+
+// WithPayload
+// Returns a copy of the envelope that carries a different payload, a stage that transforms
+// the payload pushes the copy so the metadata travels on to the next stage.
+func (envelope *Envelope) WithPayload(payload Message) *Envelope {
+	c := envelope.Clone()
+	c.Payload = payload
+	return c
+}
+
+// Clone returns a copy of the envelope whose headers and timings can be changed independently
+func (envelope *Envelope) Clone() *Envelope {
+	c := new(Envelope)
+	*c = *envelope
+
+	c.Headers = make(map[string]string, len(envelope.Headers))
+	for key, value := range envelope.Headers {
+		c.Headers[key] = value
+	}
+	c.Timings = append([]StageTiming(nil), envelope.Timings...)
+
+	return c
+}
+
+// Latency returns the time since the envelope was ingested
+func (envelope *Envelope) Latency() time.Duration {
+	if envelope.Ingested.IsZero() {
+		return 0
+	}
+	return time.Now().Sub(envelope.Ingested)
+}
+
+// stamp is called as an envelope is pushed, closing the timing of the stage that held it
+func (envelope *Envelope) stamp(now time.Time) {
+	if envelope.Ingested.IsZero() {
+		envelope.Ingested = now
+	}
+
+	if n := len(envelope.Timings); n > 0 {
+		last := &envelope.Timings[n-1]
+		if (last.Processed == 0) && !last.pulled.IsZero() {
+			last.Processed = now.Sub(last.pulled)
+		}
+	}
+	envelope.pushed = now
+}
+
+// receive is called as an envelope is pulled by the stage, returning how long it waited in the channel
+func (envelope *Envelope) receive(stage string, now time.Time) (waited time.Duration) {
+	if !envelope.pushed.IsZero() {
+		waited = now.Sub(envelope.pushed)
+	}
+
+	// channels that only merge or route data units are not a stage of their own
+	if stage != "" {
+		envelope.Timings = append(envelope.Timings, StageTiming{Stage: stage, Waited: waited, pulled: now})
+	}
+	return waited
+}
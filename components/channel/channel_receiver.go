@@ -0,0 +1,42 @@
+package channel
+
+import "sync"
+
+// Receiver
+// A view of a ManagedChannel handed to a single consumer, stopping the receiver makes
+// Pull return false for that consumer only so it can be retired without closing the channel.
+type Receiver struct {
+	channel *ManagedChannel
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func (mc *ManagedChannel) Receiver() *Receiver {
+	receiver := new(Receiver)
+
+	receiver.channel = mc
+	receiver.stop = make(chan struct{})
+
+	return receiver
+}
+
+func (receiver *Receiver) Pull() (data Message, ok bool) {
+	return receiver.channel.PullUntil(receiver.stop)
+}
+
+// Stop will take effect the next time the consumer pulls, data already pulled is not lost
+func (receiver *Receiver) Stop() {
+	receiver.stopOnce.Do(func() {
+		close(receiver.stop)
+	})
+}
+
+func (receiver *Receiver) IsStopped() bool {
+	select {
+	case <-receiver.stop:
+		return true
+	default:
+		return false
+	}
+}
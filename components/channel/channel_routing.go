@@ -0,0 +1,64 @@
+package channel
+
+import "sync"
+
+// Merge
+// Forwards every data unit of the inputs into the output and closes the output once every
+// input has been closed. Blocks until the inputs are done, or the output is cancelled in which
+// case the inputs are cancelled so their producers are released.
+func Merge(output *ManagedChannel, inputs ...*ManagedChannel) {
+	var wg sync.WaitGroup
+
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input *ManagedChannel) {
+			defer wg.Done()
+
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				output.Push(data)
+				if output.IsCancelled() {
+					input.Cancel()
+					return
+				}
+			}
+		}(input)
+	}
+
+	wg.Wait()
+	output.Close()
+}
+
+// Route
+// Forwards every data unit of the input to the outputs at the indexes returned by the route
+// function and closes the outputs once the input is done. Returns early, leaving the input
+// to the caller, once every output has been cancelled as nothing is left to route to.
+func Route(input InputChannel, outputs []*ManagedChannel, route func(data Message) []int) {
+	defer func() {
+		for _, output := range outputs {
+			output.Close()
+		}
+	}()
+
+	for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+		// an envelope is stamped by every channel it is pushed to, so each output is given its own copy
+		indexes := route(data)
+		envelope, isEnvelope := data.(*Envelope)
+		for n, i := range indexes {
+			if isEnvelope && (n < len(indexes)-1) {
+				outputs[i].Push(envelope.Clone())
+			} else {
+				outputs[i].Push(data)
+			}
+		}
+
+		cancelled := 0
+		for _, output := range outputs {
+			if output.IsCancelled() {
+				cancelled++
+			}
+		}
+		if cancelled == len(outputs) {
+			return
+		}
+	}
+}
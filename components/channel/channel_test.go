@@ -0,0 +1,138 @@
+package channel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManagedChannelMetrics(t *testing.T) {
+	mc := NewManagedChannel(3, 2, 10)
+
+	for i := 0; i < 4; i++ {
+		mc.Push(i)
+	}
+	if mc.Status() != Congested {
+		t.Errorf("expected the channel to be congested at a depth of 4, got %d", mc.Status())
+	}
+
+	mc.Pull()
+	mc.Close()
+	for _, ok := mc.Pull(); ok; _, ok = mc.Pull() {
+	}
+
+	metrics := mc.Metrics()
+	if (metrics.Enqueued != 4) || (metrics.Dequeued != 4) || (metrics.HighWaterMark != 4) || (metrics.Depth != 0) {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+	if metrics.State != Empty {
+		t.Errorf("expected the channel to be empty, got %d", metrics.State)
+	}
+}
+
+func TestManagedChannelCancel(t *testing.T) {
+	mc := NewManagedChannel(1, 2, 2)
+
+	mc.Push(1)
+	mc.Push(2)
+	mc.Cancel()
+
+	// the channel is at capacity, a cancelled channel should discard instead of blocking
+	mc.Push(3)
+
+	if _, ok := mc.Pull(); ok {
+		t.Error("a cancelled channel should not return data")
+	}
+}
+
+func TestManagedChannelTimesEnvelopes(t *testing.T) {
+	first, second := NewManagedChannel(10, 2), NewManagedChannel(10, 2)
+	first.Config.Name, second.Config.Name = "transform", "load"
+
+	envelope := Wrap("payload")
+	envelope.TraceId = "abc"
+	first.Push(envelope)
+
+	data, _ := first.Pull()
+	payload, pulled := Unwrap(data)
+	second.Push(pulled.WithPayload(payload.(string) + "!"))
+
+	data, _ = second.Pull()
+	payload, pulled = Unwrap(data)
+	if (payload != "payload!") || (pulled.TraceId != "abc") || pulled.Ingested.IsZero() {
+		t.Fatalf("the metadata did not travel with the payload, got %+v", pulled)
+	}
+	if (len(pulled.Timings) != 2) || (pulled.Timings[0].Stage != "transform") || (pulled.Timings[1].Stage != "load") {
+		t.Errorf("expected a timing for each stage, got %+v", pulled.Timings)
+	}
+	if second.Metrics().NumEnvelopes != 1 {
+		t.Errorf("expected the channel to time the envelope, got %+v", second.Metrics())
+	}
+}
+
+func TestBatchReaderFlushesOnClose(t *testing.T) {
+	mc := NewManagedChannel(10, 2)
+	for i := 0; i < 5; i++ {
+		mc.Push(i)
+	}
+	mc.Close()
+
+	batches := NewBatchReader(mc, 2, time.Minute)
+	defer batches.Close()
+
+	sizes := make([]int, 0)
+	for batch, ok := batches.Next(); ok; batch, ok = batches.Next() {
+		sizes = append(sizes, len(batch))
+	}
+	if (len(sizes) != 3) || (sizes[0] != 2) || (sizes[1] != 2) || (sizes[2] != 1) {
+		t.Errorf("expected batches of 2, 2 and the remaining 1, got %v", sizes)
+	}
+}
+
+func TestBatchReaderDefaultSize(t *testing.T) {
+	mc := NewManagedChannel(DefaultBatchSize+1, 2)
+	for i := 0; i <= DefaultBatchSize; i++ {
+		mc.Push(i)
+	}
+
+	// without a size or an interval a batch is still flushed before the input is done
+	batches := NewBatchReader(mc, 0, 0)
+	defer batches.Close()
+
+	if batch, ok := batches.Next(); !ok || (len(batch) != DefaultBatchSize) {
+		t.Errorf("expected a batch of %d, got %d", DefaultBatchSize, len(batch))
+	}
+	mc.Close()
+}
+
+func TestWindowReaderEventTime(t *testing.T) {
+	epoch := time.Unix(0, 0)
+	at := func(seconds ...int) *ManagedChannel {
+		mc := NewManagedChannel(10, 2)
+		for _, second := range seconds {
+			envelope := Wrap(second)
+			envelope.EventTime = epoch.Add(time.Duration(second) * time.Second)
+			mc.Push(envelope)
+		}
+		mc.Close()
+		return mc
+	}
+	count := func(reader *WindowReader) []int {
+		defer reader.Close()
+		counts := make([]int, 0)
+		for window, ok := reader.Next(); ok; window, ok = reader.Next() {
+			counts = append(counts, len(window.Items))
+		}
+		return counts
+	}
+	options := WindowOptions{EventTime: true}
+
+	if counts := count(NewTumblingWindows(at(1, 2, 11, 25), 10*time.Second, options)); len(counts) != 3 {
+		t.Errorf("expected 3 tumbling windows, got %v", counts)
+	}
+	if counts := count(NewSlidingWindows(at(5), 10*time.Second, 5*time.Second, options)); len(counts) != 2 {
+		t.Errorf("expected the data unit in 2 sliding windows, got %v", counts)
+	}
+	if counts := count(NewSessionWindows(at(1, 3, 5, 20, 21), 5*time.Second, options)); (len(counts) != 2) || (counts[0] != 3) {
+		t.Errorf("expected sessions of 3 and 2, got %v", counts)
+	}
+}
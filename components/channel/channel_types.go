@@ -1,6 +1,10 @@
 package channel
 
-import "sync"
+import (
+	"errors"
+	"sync"
+	"time"
+)
 
 type Status int
 
@@ -10,23 +14,164 @@ const (
 	Congested        = 2
 )
 
+const (
+	DefaultChannelCapacity = 1000
+	DefaultBatchSize       = 1000 // used by a batch reader given neither a size nor an interval
+)
+
 type Message any
 
-type OutputChannel chan<- Message
+// ErrSequenced is the panic of a batch or window reader given an input that is Sequenced
+var ErrSequenced = errors.New("an ordered input can not be batched or windowed")
+
+// OutputChannel
+// Handed to the stages that produce data, Push blocks while the channel is at capacity.
+type OutputChannel interface {
+	Push(data Message)
+}
+
+// InputChannel
+// Handed to the stages that consume data, Pull blocks until data is available and returns
+// false once the channel has been closed and emptied (or cancelled).
+type InputChannel interface {
+	Pull() (data Message, ok bool)
+}
+
+// Sequenced
+// Implemented by an InputChannel that ties what a goroutine pushes to the data unit it last
+// pulled, such as the input of a transform stage when the config is ordered. The data units of
+// a Sequenced input have to be pulled on the goroutine that pushes for them.
+type Sequenced interface {
+	Sequenced() bool
+}
+
+// Envelope
+// An optional wrapper around the payload of a data unit that carries metadata from extract
+// to load. Managed channels stamp the time the envelope was ingested and how long every stage
+// it passed through held it, the payload itself is never inspected.
+type Envelope struct {
+	Id        string            `json:"id,omitempty"`
+	Offset    string            `json:"offset,omitempty"` // the position of the data unit in its source
+	EventTime time.Time         `json:"event-time,omitempty"`
+	TraceId   string            `json:"trace-id,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	Ingested  time.Time         `json:"ingested"` // set the first time the envelope is pushed to a managed channel
+	Timings   []StageTiming     `json:"timings,omitempty"`
+	Payload   Message           `json:"payload"`
+
+	pushed time.Time
+}
+
+type StageTiming struct {
+	Stage     string        `json:"stage"`
+	Waited    time.Duration `json:"waited"`    // time spent in the channel before the stage pulled it
+	Processed time.Duration `json:"processed"` // time the stage held it before pushing it on, zero until then
+
+	pulled time.Time
+}
+
+type Batch []Message
+
+type Window struct {
+	Key   string    `json:"key,omitempty"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Items []Message `json:"items"`
+}
+
+type WindowKind uint8
+
+const (
+	Tumbling WindowKind = iota
+	Sliding
+	Session
+)
+
+type WindowOptions struct {
+	// EventTime closes windows as the time of the data units advances instead of the clock, where
+	// the time of a data unit is given by TimeOf, or the event time of its envelope when TimeOf is nil
+	EventTime bool
+	TimeOf    func(data Message) time.Time
+	KeyOf     func(data Message) string // windows are kept separately for every key when set
+}
+
+// BatchReader
+// Groups the data units of an input channel into batches of a count, an interval, or whichever
+// comes first. The batch being filled is flushed when the input channel closes.
+type BatchReader struct {
+	input    InputChannel
+	size     int
+	interval time.Duration
+
+	output    chan Batch
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WindowReader
+// Groups the data units of an input channel into tumbling, sliding or session windows. Every
+// open window is flushed when the input channel closes.
+type WindowReader struct {
+	input   InputChannel
+	kind    WindowKind
+	size    time.Duration // the length of tumbling and sliding windows, the gap of session windows
+	slide   time.Duration
+	options WindowOptions
 
-type InputChannel <-chan Message
+	open      map[string]*Window
+	watermark time.Time
+
+	output    chan Window
+	done      chan struct{}
+	closeOnce sync.Once
+}
 
 type ManagedChannelConfig struct {
+	Name         string // the stage that pulls from the channel, used to label envelope timings
 	Threshold    int
 	GrowthFactor int
-	Size         int
+	Size         int // the number of data units currently waiting in the channel
+	Capacity     int
+}
+
+type Metrics struct {
+	State         Status `json:"state"`
+	Depth         int    `json:"depth"`
+	Capacity      int    `json:"capacity"`
+	Enqueued      uint64 `json:"enqueued"`
+	Dequeued      uint64 `json:"dequeued"`
+	HighWaterMark int    `json:"high-water-mark"`
+
+	// only data units wrapped in an envelope are timed
+	NumEnvelopes uint64        `json:"num-envelopes"`
+	TotalWait    time.Duration `json:"total-wait"` // time envelopes spent waiting in the channel
+	MaxWait      time.Duration `json:"max-wait"`
+	TotalLatency time.Duration `json:"total-latency"` // time from ingestion until envelopes were pulled from the channel
+	MaxLatency   time.Duration `json:"max-latency"`
+}
+
+type envelopeMetrics struct {
+	count        uint64
+	totalWait    time.Duration
+	maxWait      time.Duration
+	totalLatency time.Duration
+	maxLatency   time.Duration
 }
 
 type ManagedChannel struct {
-	State   Status
-	Config  ManagedChannelConfig
-	Channel chan Message
+	State  Status
+	Config ManagedChannelConfig
+
+	channel       chan Message
+	enqueued      uint64
+	dequeued      uint64
+	highWaterMark int
+	envelopes     envelopeMetrics
+
+	cancelled chan struct{}
+	closeOnce sync.Once
+	stopOnce  sync.Once
 
 	mutex sync.Mutex
-	wg    sync.WaitGroup
+	empty *sync.Cond
 }
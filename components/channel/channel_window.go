@@ -0,0 +1,187 @@
+package channel
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	MinWindowTick = 10 * time.Millisecond
+)
+
+// NewTumblingWindows groups data units into back-to-back windows of the size
+func NewTumblingWindows(input InputChannel, size time.Duration, options ...WindowOptions) *WindowReader {
+	return newWindowReader(input, Tumbling, size, size, options)
+}
+
+// NewSlidingWindows groups data units into windows of the size that start every slide, a data unit can be in several windows
+func NewSlidingWindows(input InputChannel, size, slide time.Duration, options ...WindowOptions) *WindowReader {
+	return newWindowReader(input, Sliding, size, slide, options)
+}
+
+// NewSessionWindows groups data units into windows that close once no data unit arrives for the gap
+func NewSessionWindows(input InputChannel, gap time.Duration, options ...WindowOptions) *WindowReader {
+	return newWindowReader(input, Session, gap, gap, options)
+}
+
+func newWindowReader(input InputChannel, kind WindowKind, size, slide time.Duration, options []WindowOptions) *WindowReader {
+	reader := new(WindowReader)
+
+	reader.input = input
+	reader.kind = kind
+	reader.size = size
+	reader.slide = slide
+	if len(options) == 1 {
+		reader.options = options[0]
+	}
+	reader.open = make(map[string]*Window)
+	reader.output = make(chan Window)
+	reader.done = make(chan struct{})
+
+	go reader.run(pump(input, reader.done))
+
+	return reader
+}
+
+func (reader *WindowReader) run(items <-chan Message) {
+	defer close(reader.output)
+
+	// the clock only closes windows when they are measured in processing time
+	tick := reader.slide
+	if reader.size < tick {
+		tick = reader.size
+	}
+	tick /= 4
+	if tick < MinWindowTick {
+		tick = MinWindowTick
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data, ok := <-items:
+			if !ok {
+				// the input closed, every window still open is complete
+				reader.flush(func(window *Window) bool { return true })
+				return
+			}
+
+			timestamp := reader.timeOf(data)
+			reader.add(data, timestamp)
+			if timestamp.After(reader.watermark) {
+				reader.watermark = timestamp
+			}
+		case now := <-ticker.C:
+			if !reader.options.EventTime {
+				reader.watermark = now
+			}
+		case <-reader.done:
+			return
+		}
+
+		if !reader.flush(func(window *Window) bool { return !window.End.After(reader.watermark) }) {
+			return
+		}
+	}
+}
+
+func (reader *WindowReader) timeOf(data Message) time.Time {
+	if reader.options.EventTime {
+		if reader.options.TimeOf != nil {
+			return reader.options.TimeOf(data)
+		}
+		if envelope, ok := data.(*Envelope); ok && !envelope.EventTime.IsZero() {
+			return envelope.EventTime
+		}
+	}
+	return time.Now()
+}
+
+// add places the data unit in every window of its key that covers the timestamp
+func (reader *WindowReader) add(data Message, timestamp time.Time) {
+	key := ""
+	if reader.options.KeyOf != nil {
+		key = reader.options.KeyOf(data)
+	}
+
+	if reader.kind == Session {
+		// a session is extended by every data unit that arrives before the gap passes
+		for _, window := range reader.open {
+			if (window.Key == key) && !timestamp.Before(window.Start) && !timestamp.After(window.End) {
+				window.Items = append(window.Items, data)
+				if end := timestamp.Add(reader.size); end.After(window.End) {
+					window.End = end
+				}
+				return
+			}
+		}
+		reader.window(key, timestamp, timestamp.Add(reader.size)).Items = []Message{data}
+		return
+	}
+
+	// tumbling windows are sliding windows whose slide is the size
+	for start := timestamp.Truncate(reader.slide); start.Add(reader.size).After(timestamp); start = start.Add(-reader.slide) {
+		window := reader.window(key, start, start.Add(reader.size))
+		window.Items = append(window.Items, data)
+	}
+}
+
+// window returns the open window of the key starting at start, creating it if it does not exist
+func (reader *WindowReader) window(key string, start, end time.Time) *Window {
+	id := key + "/" + start.String()
+	if window, found := reader.open[id]; found {
+		return window
+	}
+
+	window := &Window{Key: key, Start: start, End: end, Items: make([]Message, 0)}
+	reader.open[id] = window
+	return window
+}
+
+// flush hands over the windows that are complete in the order they end, false if the reader was closed
+func (reader *WindowReader) flush(complete func(window *Window) bool) bool {
+	ids := make([]string, 0)
+	for id, window := range reader.open {
+		if complete(window) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := reader.open[ids[i]], reader.open[ids[j]]
+		if a.End.Equal(b.End) {
+			return a.Key < b.Key
+		}
+		return a.End.Before(b.End)
+	})
+
+	for _, id := range ids {
+		window := reader.open[id]
+		delete(reader.open, id)
+
+		select {
+		case reader.output <- *window:
+		case <-reader.done:
+			return false
+		}
+	}
+	return true
+}
+
+// Next blocks until a window is complete, ok is false once the input is done and every window was returned
+func (reader *WindowReader) Next() (window Window, ok bool) {
+	window, ok = <-reader.output
+	return window, ok
+}
+
+// Pull lets the reader be used as an InputChannel, where every data unit is a Window
+func (reader *WindowReader) Pull() (data Message, ok bool) {
+	return reader.Next()
+}
+
+// Close stops the reader when the stage returns before the input is done
+func (reader *WindowReader) Close() {
+	reader.closeOnce.Do(func() {
+		close(reader.done)
+	})
+}
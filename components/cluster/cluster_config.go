@@ -2,6 +2,9 @@ package cluster
 
 import "fmt"
 
+// NewConfig
+// Creates a config for the cluster identifier, a mode of Restart re-provisions the cluster when
+// it crashes while DoNothing only reports the crash.
 func NewConfig(identifier string, etChannelThreshold, etChannelGrowthFactor, tlChannelThreshold, tlChannelGrowthFactor int, mode OnCrash) *Config {
 	config := new(Config)
 
@@ -10,11 +13,16 @@ func NewConfig(identifier string, etChannelThreshold, etChannelGrowthFactor, tlC
 	config.ETChannelGrowthFactor = etChannelGrowthFactor
 	config.TLChannelThreshold = tlChannelThreshold
 	config.TLChannelGrowthFactor = tlChannelGrowthFactor
-	config.Mode = mode
+	config.Mode = &mode
 
 	return config
 }
 
+// RestartsOnCrash returns true if the config asks for the cluster to be re-provisioned when it crashes
+func (config Config) RestartsOnCrash() bool {
+	return (config.Mode != nil) && (*config.Mode == Restart)
+}
+
 func (config Config) Print() {
 	fmt.Printf("Identifier:\t%s\n", config.Identifier)
 	fmt.Printf("StartWithNTransform:\t%d\n", config.StartWithNTransformClusters)
@@ -23,4 +31,16 @@ func (config Config) Print() {
 	fmt.Printf("ETChannelGrowthFactor:\t%d\n", config.ETChannelGrowthFactor)
 	fmt.Printf("TLChannelThreshold:\t%d\n", config.TLChannelThreshold)
 	fmt.Printf("TLChannelGrowthFactor:\t%d\n", config.TLChannelGrowthFactor)
+	fmt.Printf("MaxRuntime:\t%.2fm\n", config.MaxRuntime)
+	fmt.Printf("MaxRestarts:\t%d\n", config.MaxRestarts)
+	fmt.Printf("RestartBackoff:\t%.2fs\n", config.RestartBackoff)
+	fmt.Printf("RestartWindow:\t%.2fm\n", config.RestartWindow)
+	fmt.Printf("TransformRoutines:\t%d-%d\n", config.MinTransformRoutines, config.MaxTransformRoutines)
+	fmt.Printf("LoadRoutines:\t%d-%d\n", config.MinLoadRoutines, config.MaxLoadRoutines)
+	fmt.Printf("ScaleDownCooldown:\t%.2fs\n", config.ScaleDownCooldown)
+	fmt.Printf("ScalingPolicy:\t%s\n", config.ScalingPolicy)
+	fmt.Printf("RetryMaxAttempts:\t%d\n", config.RetryMaxAttempts)
+	fmt.Printf("RetryBackoff:\t%.2fs\n", config.RetryBackoff)
+	fmt.Printf("Ordered:\t%t\n", config.Ordered)
+	fmt.Printf("ReorderBufferSize:\t%d\n", config.ReorderBufferSize)
 }
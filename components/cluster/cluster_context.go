@@ -0,0 +1,38 @@
+package cluster
+
+import (
+	"context"
+	"github.com/GabeCordo/etl/components/channel"
+)
+
+// contextAdapter lets a structure that only implements the ContextCluster interface be
+// registered with the core, the Cluster functions are only used if the adapter is driven
+// by something other than a supervisor
+type contextAdapter struct {
+	ContextCluster
+}
+
+func WithContext(implementation ContextCluster) Cluster {
+	return contextAdapter{implementation}
+}
+
+// unwrap returns the structure behind an adapter, so the optional interfaces it implements, such as
+// Partitioned, Parameterized or the hooks, are found even though the adapter does not implement them
+func unwrap(implementation Cluster) any {
+	if adapter, ok := implementation.(contextAdapter); ok {
+		return adapter.ContextCluster
+	}
+	return implementation
+}
+
+func (adapter contextAdapter) ExtractFunc(output channel.OutputChannel) {
+	adapter.ExtractFuncWithContext(context.Background(), output)
+}
+
+func (adapter contextAdapter) TransformFunc(input channel.InputChannel, output channel.OutputChannel) {
+	adapter.TransformFuncWithContext(context.Background(), input, output)
+}
+
+func (adapter contextAdapter) LoadFunc(input channel.InputChannel) {
+	adapter.LoadFuncWithContext(context.Background(), input)
+}
@@ -0,0 +1,37 @@
+package cluster
+
+import (
+	"context"
+	"github.com/GabeCordo/etl/components/channel"
+)
+
+type errorOutputKey struct{}
+
+// ErrorOutput
+// Receives the data units a transform or load stage rejects, the supervisor sends them to the
+// dead-letter store of the cluster so the stage can skip a bad data unit and keep going.
+type ErrorOutput interface {
+	Reject(data channel.Message, err error)
+}
+
+// WithErrorOutput returns a copy of the context that carries the error output of a stage
+func WithErrorOutput(ctx context.Context, output ErrorOutput) context.Context {
+	return context.WithValue(ctx, errorOutputKey{}, output)
+}
+
+// ErrorOutputFromContext returns the error output the supervisor gave the stage
+func ErrorOutputFromContext(ctx context.Context) (ErrorOutput, bool) {
+	output, ok := ctx.Value(errorOutputKey{}).(ErrorOutput)
+	return output, ok
+}
+
+// Reject
+// Sends the data unit to the error output of the stage, returns false if the stage was not
+// given an error output, such as when it is an extract stage or was not started by a supervisor.
+func Reject(ctx context.Context, data channel.Message, err error) bool {
+	if output, ok := ErrorOutputFromContext(ctx); ok {
+		output.Reject(data, err)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package cluster
+
+// HooksOf
+// Returns the lifecycle hooks of a cluster, those set on a pipeline or the hook interfaces the
+// cluster implements. A cluster registered using WithContext is checked for the interfaces too.
+func HooksOf(implementation Cluster) Hooks {
+	if pipeline, ok := implementation.(*Pipeline); ok {
+		return pipeline.hooks
+	}
+
+	group := unwrap(implementation)
+
+	hooks := Hooks{}
+	if hook, ok := group.(SetupHook); ok {
+		hooks.Setup = hook.Setup
+	}
+	if hook, ok := group.(TeardownHook); ok {
+		hooks.Teardown = hook.Teardown
+	}
+	if hook, ok := group.(WorkerHook); ok {
+		hooks.SetupWorker = hook.SetupWorker
+	}
+	if hook, ok := group.(FailureHook); ok {
+		hooks.OnFailure = hook.OnFailure
+	}
+	return hooks
+}
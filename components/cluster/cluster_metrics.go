@@ -0,0 +1,101 @@
+package cluster
+
+import "sort"
+
+// DefaultHistogramBuckets are the upper bounds of the buckets every histogram is created with
+var DefaultHistogramBuckets = []float64{1, 5, 10, 50, 100, 500, 1000, 5000, 10000, 50000, 100000}
+
+func NewHistogram(buckets ...float64) *Histogram {
+	histogram := new(Histogram)
+
+	if len(buckets) == 0 {
+		buckets = DefaultHistogramBuckets
+	}
+	histogram.Buckets = make([]float64, len(buckets))
+	copy(histogram.Buckets, buckets)
+	sort.Float64s(histogram.Buckets)
+	histogram.Counts = make([]int64, len(buckets)+1)
+
+	return histogram
+}
+
+// Observe adds the value to the bucket it falls into, a value equal to the upper bound of a bucket belongs to it
+func (histogram *Histogram) Observe(value float64) {
+	if (histogram.Count == 0) || (value < histogram.Min) {
+		histogram.Min = value
+	}
+	if (histogram.Count == 0) || (value > histogram.Max) {
+		histogram.Max = value
+	}
+	histogram.Count++
+	histogram.Sum += value
+
+	histogram.Counts[sort.SearchFloat64s(histogram.Buckets, value)]++
+}
+
+// Mean returns the average of the observed values, 0 if nothing was observed
+func (histogram *Histogram) Mean() float64 {
+	if histogram.Count == 0 {
+		return 0
+	}
+	return histogram.Sum / float64(histogram.Count)
+}
+
+// Add adds the delta to the named counter
+func (metrics *Metrics) Add(name string, delta int64) {
+	if metrics.Counters == nil {
+		metrics.Counters = make(map[string]int64)
+	}
+	metrics.Counters[name] += delta
+}
+
+// Set sets the named gauge to the value
+func (metrics *Metrics) Set(name string, value float64) {
+	if metrics.Gauges == nil {
+		metrics.Gauges = make(map[string]float64)
+	}
+	metrics.Gauges[name] = value
+}
+
+// Observe adds the value to the named histogram, it is created with the default buckets the first time it is observed
+func (metrics *Metrics) Observe(name string, value float64) {
+	if metrics.Histograms == nil {
+		metrics.Histograms = make(map[string]*Histogram)
+	}
+
+	histogram, found := metrics.Histograms[name]
+	if !found {
+		histogram = NewHistogram()
+		metrics.Histograms[name] = histogram
+	}
+	histogram.Observe(value)
+}
+
+// Copy returns a copy of the metrics that does not share any maps or histograms with the original
+func (metrics Metrics) Copy() Metrics {
+	c := Metrics{}
+
+	if metrics.Counters != nil {
+		c.Counters = make(map[string]int64, len(metrics.Counters))
+		for name, value := range metrics.Counters {
+			c.Counters[name] = value
+		}
+	}
+	if metrics.Gauges != nil {
+		c.Gauges = make(map[string]float64, len(metrics.Gauges))
+		for name, value := range metrics.Gauges {
+			c.Gauges[name] = value
+		}
+	}
+	if metrics.Histograms != nil {
+		c.Histograms = make(map[string]*Histogram, len(metrics.Histograms))
+		for name, histogram := range metrics.Histograms {
+			h := *histogram
+			h.Buckets = append([]float64(nil), histogram.Buckets...)
+			h.Counts = append([]int64(nil), histogram.Counts...)
+			c.Histograms[name] = &h
+		}
+	}
+
+	return c
+}
@@ -0,0 +1,170 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	DateLayout = "2006-01-02"
+)
+
+type parametersKey struct{}
+
+// WithParameters returns a copy of the context that carries the runtime parameters of the supervisor
+func WithParameters(ctx context.Context, parameters Parameters) context.Context {
+	return context.WithValue(ctx, parametersKey{}, parameters)
+}
+
+// ParametersFromContext returns the runtime parameters the supervisor was provisioned with, empty if there are none
+func ParametersFromContext(ctx context.Context) Parameters {
+	if parameters, ok := ctx.Value(parametersKey{}).(Parameters); ok {
+		return parameters
+	}
+	return Parameters{}
+}
+
+// SchemaOf returns the runtime parameters a cluster declares, false if it does not declare a schema
+func SchemaOf(implementation Cluster) ([]ParameterSpec, bool) {
+	if parameterized, ok := unwrap(implementation).(Parameterized); ok {
+		schema := parameterized.Parameters()
+		return schema, schema != nil
+	}
+	return nil, false
+}
+
+// ValidateParameters
+// Checks the parameters against the schema the cluster declares, converting every value to the
+// declared type and filling in the defaults. A cluster that declares no schema accepts any
+// parameters as they are given.
+func ValidateParameters(implementation Cluster, parameters Parameters) (validated Parameters, success bool, description string) {
+	validated = make(Parameters)
+
+	schema, declared := SchemaOf(implementation)
+	if !declared {
+		for name, value := range parameters {
+			validated[name] = value
+		}
+		return validated, true, ""
+	}
+
+	specs := make(map[string]ParameterSpec)
+	for _, spec := range schema {
+		specs[spec.Name] = spec
+	}
+	for name := range parameters {
+		if _, found := specs[name]; !found {
+			return nil, false, fmt.Sprintf("unknown parameter %s", name)
+		}
+	}
+
+	for _, spec := range schema {
+		value, found := parameters[spec.Name]
+		if !found {
+			if spec.Required {
+				return nil, false, fmt.Sprintf("missing required parameter %s", spec.Name)
+			}
+			if spec.Default == nil {
+				continue
+			}
+			value = spec.Default
+		}
+
+		converted, ok := convertParameter(spec.Type, value)
+		if !ok {
+			return nil, false, fmt.Sprintf("parameter %s should be a %s", spec.Name, spec.Type)
+		}
+		validated[spec.Name] = converted
+	}
+
+	return validated, true, ""
+}
+
+// convertParameter converts a value decoded from JSON to the go type of the parameter type
+func convertParameter(parameterType ParameterType, value any) (any, bool) {
+	switch parameterType {
+	case StringParameter:
+		s, ok := value.(string)
+		return s, ok
+	case IntParameter:
+		switch v := value.(type) {
+		case int:
+			return v, true
+		case int64:
+			return int(v), true
+		case float64:
+			// JSON numbers are decoded as floats, only whole numbers are accepted
+			if v == math.Trunc(v) {
+				return int(v), true
+			}
+		}
+		return nil, false
+	case FloatParameter:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case int:
+			return float64(v), true
+		}
+		return nil, false
+	case BoolParameter:
+		b, ok := value.(bool)
+		return b, ok
+	case TimeParameter:
+		switch v := value.(type) {
+		case time.Time:
+			return v, true
+		case string:
+			if t, err := time.Parse(time.RFC3339, v); err == nil {
+				return t, true
+			}
+			if t, err := time.Parse(DateLayout, v); err == nil {
+				return t, true
+			}
+		}
+		return nil, false
+	default:
+		return nil, false
+	}
+}
+
+// String returns the named parameter, false if it was not given or is not a string
+func (parameters Parameters) String(name string) (string, bool) {
+	s, ok := parameters[name].(string)
+	return s, ok
+}
+
+// Int returns the named parameter, false if it was not given or is not a whole number
+func (parameters Parameters) Int(name string) (int, bool) {
+	i, ok := convertParameter(IntParameter, parameters[name])
+	if !ok {
+		return 0, false
+	}
+	return i.(int), true
+}
+
+// Float returns the named parameter, false if it was not given or is not a number
+func (parameters Parameters) Float(name string) (float64, bool) {
+	f, ok := convertParameter(FloatParameter, parameters[name])
+	if !ok {
+		return 0, false
+	}
+	return f.(float64), true
+}
+
+// Bool returns the named parameter, false if it was not given or is not a bool
+func (parameters Parameters) Bool(name string) (bool, bool) {
+	b, ok := parameters[name].(bool)
+	return b, ok
+}
+
+// Time returns the named parameter, false if it was not given or is not a timestamp or date
+func (parameters Parameters) Time(name string) (time.Time, bool) {
+	t, ok := convertParameter(TimeParameter, parameters[name])
+	if !ok {
+		return time.Time{}, false
+	}
+	return t.(time.Time), true
+}
@@ -0,0 +1,316 @@
+package cluster
+
+import (
+	"context"
+	"github.com/GabeCordo/etl/components/channel"
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	DefaultStageThreshold    = 10
+	DefaultStageGrowthFactor = 2
+	DefaultStageStartWith    = 1
+)
+
+func NewPipeline() *Pipeline {
+	pipeline := new(Pipeline)
+
+	pipeline.extracts = make([]*Stage, 0)
+	pipeline.transforms = make([]*Stage, 0)
+	pipeline.loads = make([]*Stage, 0)
+	pipeline.fanOut = Broadcast
+
+	return pipeline
+}
+
+// NewDefaultPipeline
+// Describes a Cluster as the three stage extract, transform and load pipeline the supervisor
+// runs it as. The context aware functions are used when the cluster implements ContextCluster,
+// and the transform stage is partitioned when it implements Partitioned.
+func NewDefaultPipeline(implementation Cluster, config Config) *Pipeline {
+	pipeline := NewPipeline()
+
+	contextGroup, isContextAware := implementation.(ContextCluster)
+
+	var partitionBy KeyFunc
+	if partitioned, isPartitioned := unwrap(implementation).(Partitioned); isPartitioned {
+		partitionBy = partitioned.PartitionKey
+	}
+
+	extract := newStage("extract", Extract, StageConfig{StartWith: DefaultStageStartWith},
+		func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			if isContextAware {
+				contextGroup.ExtractFuncWithContext(ctx, output)
+			} else {
+				implementation.ExtractFunc(output)
+			}
+		})
+	pipeline.transforms = append(pipeline.transforms, newStage("transform", Transform, StageConfig{
+		Threshold:    config.ETChannelThreshold,
+		GrowthFactor: config.ETChannelGrowthFactor,
+		Capacity:     config.ETChannelCapacity,
+		StartWith:    config.StartWithNTransformClusters,
+		MinRoutines:  config.MinTransformRoutines,
+		MaxRoutines:  config.MaxTransformRoutines,
+		PartitionBy:  partitionBy,
+	}, func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+		if isContextAware {
+			contextGroup.TransformFuncWithContext(ctx, input, output)
+		} else {
+			implementation.TransformFunc(input, output)
+		}
+	}))
+	load := newStage("load", Load, StageConfig{
+		Threshold:    config.TLChannelThreshold,
+		GrowthFactor: config.TLChannelGrowthFactor,
+		Capacity:     config.TLChannelCapacity,
+		StartWith:    config.StartWithNLoadClusters,
+		MinRoutines:  config.MinLoadRoutines,
+		MaxRoutines:  config.MaxLoadRoutines,
+	}, func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+		if isContextAware {
+			contextGroup.LoadFuncWithContext(ctx, input)
+		} else {
+			implementation.LoadFunc(input)
+		}
+	})
+
+	pipeline.extracts = append(pipeline.extracts, extract)
+	pipeline.loads = append(pipeline.loads, load)
+
+	return pipeline
+}
+
+func newStage(name string, segment Segment, config StageConfig, run TransformStage) *Stage {
+	stage := new(Stage)
+
+	stage.Name = name
+	stage.Segment = segment
+	stage.Config = config
+	stage.run = run
+
+	return stage
+}
+
+// stageConfig returns the optional config of a stage, fields that are not set use the defaults
+func stageConfig(config []StageConfig) StageConfig {
+	c := StageConfig{}
+	if len(config) == 1 {
+		c = config[0]
+	}
+
+	if c.Threshold <= 0 {
+		c.Threshold = DefaultStageThreshold
+	}
+	if c.GrowthFactor <= 0 {
+		c.GrowthFactor = DefaultStageGrowthFactor
+	}
+	if c.StartWith <= 0 {
+		c.StartWith = DefaultStageStartWith
+	}
+
+	return c
+}
+
+// Extract adds a stage the pipeline starts with, the data of every extract stage is merged
+func (pipeline *Pipeline) Extract(name string, extract ExtractStage, config ...StageConfig) *Pipeline {
+	pipeline.extracts = append(pipeline.extracts, newStage(name, Extract, stageConfig(config),
+		func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			extract(ctx, output)
+		}))
+	return pipeline
+}
+
+// Transform adds a stage that runs after every transform stage added before it
+func (pipeline *Pipeline) Transform(name string, transform TransformStage, config ...StageConfig) *Pipeline {
+	pipeline.transforms = append(pipeline.transforms, newStage(name, Transform, stageConfig(config), transform))
+	return pipeline
+}
+
+// Load adds a stage the pipeline ends with, data is fanned out to the load stages as set by FanOut
+func (pipeline *Pipeline) Load(name string, load LoadStage, config ...StageConfig) *Pipeline {
+	pipeline.loads = append(pipeline.loads, newStage(name, Load, stageConfig(config),
+		func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			load(ctx, input)
+		}))
+	return pipeline
+}
+
+// FanOut sets how data is routed when there are several load stages, ByKey requires a KeyFunc
+func (pipeline *Pipeline) FanOut(mode FanOut, key ...KeyFunc) *Pipeline {
+	pipeline.fanOut = mode
+	if len(key) == 1 {
+		pipeline.key = key[0]
+	}
+	return pipeline
+}
+
+// Declare adds runtime parameters the pipeline accepts, see Parameterized
+func (pipeline *Pipeline) Declare(parameters ...ParameterSpec) *Pipeline {
+	pipeline.parameters = append(pipeline.parameters, parameters...)
+	return pipeline
+}
+
+// Parameters returns the runtime parameters declared by the pipeline
+func (pipeline *Pipeline) Parameters() []ParameterSpec {
+	return pipeline.parameters
+}
+
+// Hooks sets the lifecycle hooks of the pipeline, see SetupHook and the other hook interfaces
+func (pipeline *Pipeline) Hooks(hooks Hooks) *Pipeline {
+	pipeline.hooks = hooks
+	return pipeline
+}
+
+// IsValid returns true once the pipeline has an extract and a load stage it knows how to route to
+func (pipeline *Pipeline) IsValid() bool {
+	if (pipeline.fanOut == ByKey) && (pipeline.key == nil) {
+		return false
+	}
+	return (len(pipeline.extracts) > 0) && (len(pipeline.loads) > 0)
+}
+
+// Router
+// Returns the indexes of the load stages a data unit should be pushed to, in the order the
+// load stages were added to the pipeline.
+func (pipeline *Pipeline) Router() func(data channel.Message) []int {
+	all := make([]int, len(pipeline.loads))
+	byName := make(map[string][]int)
+	for i, load := range pipeline.loads {
+		all[i] = i
+		byName[load.Name] = []int{i}
+	}
+
+	if (pipeline.fanOut != ByKey) || (pipeline.key == nil) {
+		return func(data channel.Message) []int {
+			return all
+		}
+	}
+
+	return func(data channel.Message) []int {
+		key := pipeline.key(data)
+		if route, found := byName[key]; found {
+			return route
+		}
+
+		hash := fnv.New32a()
+		hash.Write([]byte(key))
+		index := int(hash.Sum32() % uint32(len(all)))
+		return all[index : index+1]
+	}
+}
+
+// Stages returns the stages of the pipeline in the order data flows through them
+func (pipeline *Pipeline) Stages() []Stage {
+	stages := make([]Stage, 0, len(pipeline.extracts)+len(pipeline.transforms)+len(pipeline.loads))
+
+	for _, extract := range pipeline.extracts {
+		stages = append(stages, *extract)
+	}
+	for _, transform := range pipeline.transforms {
+		stages = append(stages, *transform)
+	}
+	for _, load := range pipeline.loads {
+		stages = append(stages, *load)
+	}
+
+	return stages
+}
+
+// Run calls the function of the stage, input is nil for extract stages and output is nil for load stages
+func (stage Stage) Run(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+	stage.run(ctx, input, output)
+}
+
+/**
+ * A Pipeline implements the Cluster and ContextCluster interfaces so that it can be registered
+ * with the core like any other cluster. The supervisor runs every stage with its own channel,
+ * these functions are only used if the pipeline is driven by something other than a supervisor.
+ */
+
+func (pipeline *Pipeline) ExtractFunc(output channel.OutputChannel) {
+	pipeline.ExtractFuncWithContext(context.Background(), output)
+}
+
+func (pipeline *Pipeline) TransformFunc(input channel.InputChannel, output channel.OutputChannel) {
+	pipeline.TransformFuncWithContext(context.Background(), input, output)
+}
+
+func (pipeline *Pipeline) LoadFunc(input channel.InputChannel) {
+	pipeline.LoadFuncWithContext(context.Background(), input)
+}
+
+// ExtractFuncWithContext runs every extract stage as a single goroutine pushing to the output
+func (pipeline *Pipeline) ExtractFuncWithContext(ctx context.Context, output channel.OutputChannel) {
+	var wg sync.WaitGroup
+
+	for _, extract := range pipeline.extracts {
+		wg.Add(1)
+		go func(extract *Stage) {
+			defer wg.Done()
+			extract.Run(ctx, nil, output)
+		}(extract)
+	}
+
+	wg.Wait()
+}
+
+// TransformFuncWithContext chains the transform stages together, each running as a single goroutine
+func (pipeline *Pipeline) TransformFuncWithContext(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+	// a pipeline without transform stages hands the data units straight to the load stage
+	if len(pipeline.transforms) == 0 {
+		for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+			output.Push(data)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	for i, transform := range pipeline.transforms {
+		if i == len(pipeline.transforms)-1 {
+			transform.Run(ctx, input, output)
+			break
+		}
+
+		// the channel belongs to the stage pulling from it
+		config := pipeline.transforms[i+1].Config
+		next := channel.NewManagedChannel(config.Threshold, config.GrowthFactor, config.Capacity)
+		wg.Add(1)
+		go func(transform *Stage, input channel.InputChannel) {
+			defer wg.Done()
+			defer next.Close()
+			transform.Run(ctx, input, next)
+		}(transform, input)
+		input = next
+	}
+
+	wg.Wait()
+}
+
+// LoadFuncWithContext routes the input to every load stage, each running as a single goroutine
+func (pipeline *Pipeline) LoadFuncWithContext(ctx context.Context, input channel.InputChannel) {
+	if len(pipeline.loads) == 1 {
+		pipeline.loads[0].Run(ctx, input, nil)
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	outputs := make([]*channel.ManagedChannel, len(pipeline.loads))
+	for i, load := range pipeline.loads {
+		outputs[i] = channel.NewManagedChannel(load.Config.Threshold, load.Config.GrowthFactor, load.Config.Capacity)
+
+		wg.Add(1)
+		go func(load *Stage, input *channel.ManagedChannel) {
+			defer wg.Done()
+			// a load stage that returns early should not leave the router blocked
+			defer input.Cancel()
+			load.Run(ctx, input, nil)
+		}(load, outputs[i])
+	}
+
+	channel.Route(input, outputs, pipeline.Router())
+	wg.Wait()
+}
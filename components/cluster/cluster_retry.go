@@ -0,0 +1,110 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"github.com/GabeCordo/etl/components/channel"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRetryBackoff    = 0.5 // seconds
+	DefaultRetryMaxBackoff = 30  // seconds
+	DefaultRetryJitter     = 0.2
+)
+
+type retrierKey struct{}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks an error that should never be retried, no matter the retry-on of the config
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func NewRetryPolicy(config Config) RetryPolicy {
+	policy := RetryPolicy{
+		MaxAttempts: config.RetryMaxAttempts,
+		Backoff:     time.Duration(config.RetryBackoff * float64(time.Second)),
+		MaxBackoff:  time.Duration(config.RetryMaxBackoff * float64(time.Second)),
+		Jitter:      config.RetryJitter,
+		RetryOn:     config.RetryOn,
+	}
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 1
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = time.Duration(DefaultRetryBackoff * float64(time.Second))
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = DefaultRetryMaxBackoff * time.Second
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = DefaultRetryJitter
+	} else if policy.Jitter < 0 {
+		policy.Jitter = 0
+	}
+	policy.Jitter = math.Min(policy.Jitter, 1)
+
+	return policy
+}
+
+// IsRetryable returns true if the error is not permanent and matches the retry-on of the config
+func (policy RetryPolicy) IsRetryable(err error) bool {
+	var permanent permanentError
+	if (err == nil) || errors.As(err, &permanent) {
+		return false
+	}
+
+	if len(policy.RetryOn) == 0 {
+		return true
+	}
+	for _, match := range policy.RetryOn {
+		if strings.Contains(err.Error(), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// Delay
+// Returns how long to wait before the next attempt, the backoff doubles after every failed
+// attempt up to the max backoff and is then spread by up to the jitter in either direction.
+func (policy RetryPolicy) Delay(attempt int) time.Duration {
+	delay := math.Min(float64(policy.Backoff)*math.Pow(2, float64(attempt-1)), float64(policy.MaxBackoff))
+	delay += delay * policy.Jitter * (2*rand.Float64() - 1)
+	return time.Duration(delay)
+}
+
+// WithRetrier returns a copy of the context that carries the retrier of a stage
+func WithRetrier(ctx context.Context, retrier Retrier) context.Context {
+	return context.WithValue(ctx, retrierKey{}, retrier)
+}
+
+// Retry
+// Runs the operation following the retry policy of the cluster, where the data unit being
+// processed is dead-lettered if the operation never succeeds. Outside of a supervisor the
+// operation is attempted once.
+func Retry(ctx context.Context, data channel.Message, operation func(ctx context.Context) error) error {
+	if retrier, ok := ctx.Value(retrierKey{}).(Retrier); ok {
+		return retrier.Do(ctx, data, operation)
+	}
+	return operation(ctx)
+}
@@ -0,0 +1,94 @@
+package cluster
+
+import (
+	"context"
+	"log"
+)
+
+type runKey struct{}
+
+// WithRun returns a copy of the context that carries the run of the supervisor
+func WithRun(ctx context.Context, run *Run) context.Context {
+	return context.WithValue(ctx, runKey{}, run)
+}
+
+// RunFromContext
+// Returns the run the supervisor gave the stage. A stage that was not started by a supervisor is
+// given an empty run and false, logging through an empty run writes to the standard logger.
+func RunFromContext(ctx context.Context) (*Run, bool) {
+	if run, ok := ctx.Value(runKey{}).(*Run); ok && (run != nil) {
+		return run, true
+	}
+	return &Run{Parameters: Parameters{}}, false
+}
+
+// Log writes the message to the log of the supervisor
+func (run *Run) Log(message string) {
+	if run.Logger != nil {
+		run.Logger.Log(message)
+	} else {
+		log.Printf("[%s:%d] %s\n", run.Config, run.Supervisor, message)
+	}
+}
+
+// Warning writes the message to the log of the supervisor as a warning
+func (run *Run) Warning(message string) {
+	if run.Logger != nil {
+		run.Logger.Warning(message)
+	} else {
+		log.Printf("[%s:%d] (warning) %s\n", run.Config, run.Supervisor, message)
+	}
+}
+
+// Fatal writes the message to the log of the supervisor as a fatal error, it does not stop the stage
+func (run *Run) Fatal(message string) {
+	if run.Logger != nil {
+		run.Logger.Fatal(message)
+	} else {
+		log.Printf("[%s:%d] (fatal) %s\n", run.Config, run.Supervisor, message)
+	}
+}
+
+// Save stores the data in the cache, returning the identifier it can be loaded by
+func (run *Run) Save(data any) (identifier string, success bool) {
+	if run.Cache == nil {
+		return "", false
+	}
+	return run.Cache.Save(data)
+}
+
+// Load returns the data stored in the cache under the identifier, false if it expired or never existed
+func (run *Run) Load(identifier string) (data any, success bool) {
+	if run.Cache == nil {
+		return nil, false
+	}
+	return run.Cache.Load(identifier)
+}
+
+// Count adds the delta to the named counter of the supervisor
+func (run *Run) Count(name string, delta int64) {
+	if run.Metrics != nil {
+		run.Metrics.Add(name, delta)
+	}
+}
+
+// Gauge sets the named gauge of the supervisor to the value
+func (run *Run) Gauge(name string, value float64) {
+	if run.Metrics != nil {
+		run.Metrics.Set(name, value)
+	}
+}
+
+// Observe adds the value to the named histogram of the supervisor
+func (run *Run) Observe(name string, value float64) {
+	if run.Metrics != nil {
+		run.Metrics.Observe(name, value)
+	}
+}
+
+// Output records a value the clusters downstream of the run are given when it runs as part of a workflow
+func (run *Run) Output(name string, value any) {
+	if run.Outputs != nil {
+		run.Outputs.Output(name, value)
+	}
+}
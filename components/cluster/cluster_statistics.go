@@ -10,3 +10,15 @@ func NewStatistics() *Statistics {
 
 	return stats
 }
+
+// Copy returns a copy of the statistics that does not share any slices or metrics with the original
+func (stats Statistics) Copy() *Statistics {
+	c := stats
+
+	c.Restarts = append([]RestartAttempt(nil), stats.Restarts...)
+	c.ScaleEvents = append([]ScaleEvent(nil), stats.ScaleEvents...)
+	c.Stages = append([]StageStatistics(nil), stats.Stages...)
+	c.Metrics = stats.Metrics.Copy()
+
+	return &c
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestConfigOnCrash(t *testing.T) {
+	var config Config
+
+	if err := json.Unmarshal([]byte(`{"identifier": "multiply", "on-crash": 0}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if !config.RestartsOnCrash() {
+		t.Error("expected an on-crash of 0 to restart")
+	}
+
+	config = Config{}
+	if err := json.Unmarshal([]byte(`{"identifier": "multiply", "on-crash": 1}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.RestartsOnCrash() {
+		t.Error("expected an on-crash of 1 to only report the crash")
+	}
+
+	config = Config{}
+	if err := json.Unmarshal([]byte(`{"identifier": "multiply"}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if (config.Mode != nil) || config.RestartsOnCrash() {
+		t.Error("expected a config without on-crash to only report the crash")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	var metrics Metrics
+
+	metrics.Add("rows", 2)
+	metrics.Add("rows", 3)
+	metrics.Set("lag", 10)
+	metrics.Set("lag", 4.5)
+	for _, value := range []float64{0.5, 1, 7, 200000} {
+		metrics.Observe("latency", value)
+	}
+
+	if (metrics.Counters["rows"] != 5) || (metrics.Gauges["lag"] != 4.5) {
+		t.Errorf("expected a counter of 5 and a gauge of 4.5, got %d and %f", metrics.Counters["rows"], metrics.Gauges["lag"])
+	}
+
+	histogram := metrics.Histograms["latency"]
+	if (histogram.Count != 4) || (histogram.Min != 0.5) || (histogram.Max != 200000) || (histogram.Mean() != 200008.5/4) {
+		t.Errorf("expected 4 observations between 0.5 and 200000, got %+v", histogram)
+	}
+	// a value equal to the bound of a bucket falls into it, a value past every bound into the last bucket
+	if (histogram.Counts[0] != 2) || (histogram.Counts[2] != 1) || (histogram.Counts[len(histogram.Buckets)] != 1) {
+		t.Errorf("the values were not counted in the expected buckets, got %v", histogram.Counts)
+	}
+	if NewHistogram().Mean() != 0 {
+		t.Error("expected a histogram without observations to have a mean of 0")
+	}
+}
+
+func TestStatisticsCopy(t *testing.T) {
+	stats := NewStatistics()
+	stats.Stages = []StageStatistics{{Name: "numbers"}}
+	stats.Metrics.Add("rows", 1)
+	stats.Metrics.Observe("latency", 1)
+
+	c := stats.Copy()
+	stats.Stages[0].NumProvisioned++
+	stats.Metrics.Add("rows", 1)
+	stats.Metrics.Observe("latency", 1)
+
+	if (c.Stages[0].NumProvisioned != 0) || (c.Metrics.Counters["rows"] != 1) || (c.Metrics.Histograms["latency"].Count != 1) {
+		t.Errorf("expected the copy not to change with the original, got %+v", c)
+	}
+}
@@ -1,6 +1,7 @@
 package cluster
 
 import (
+	"context"
 	"github.com/GabeCordo/etl/components/channel"
 	"time"
 )
@@ -15,34 +16,335 @@ const (
 
 type OnCrash int8
 
+// a config that leaves out "on-crash" has a nil Mode and only reports a crash, restarts are opt-in
 const (
 	Restart   OnCrash = 0
 	DoNothing         = 1
 )
 
+type OnWorkerPanic int8
+
+// a config that leaves out "on-worker-panic" replaces the goroutine, unless it belongs to an extract stage
+// and "replace-extract-workers" is not set, in which case the attempt fails
+const (
+	ReplaceWorker  OnWorkerPanic = 0
+	FailSupervisor               = 1
+	IgnorePanic                  = 2
+)
+
 type Cluster interface {
 	ExtractFunc(output channel.OutputChannel)
 	TransformFunc(input channel.InputChannel, output channel.OutputChannel)
 	LoadFunc(input channel.InputChannel)
 }
 
+// ContextCluster
+// An optional variant of the Cluster interface. When a registered Cluster also implements
+// ContextCluster the supervisor will call the *WithContext functions instead, where the
+// context is cancelled on teardown, when an operator stops the supervisor, or when the
+// max-runtime deadline of the config passes.
+type ContextCluster interface {
+	ExtractFuncWithContext(ctx context.Context, output channel.OutputChannel)
+	TransformFuncWithContext(ctx context.Context, input channel.InputChannel, output channel.OutputChannel)
+	LoadFuncWithContext(ctx context.Context, input channel.InputChannel)
+}
+
+// Partitioned
+// An optional interface of a Cluster. When a registered Cluster also implements Partitioned
+// its transform stage is run partitioned, every data unit with the same key is handed to the
+// same transform goroutine so per-key state and ordering is kept within a single goroutine.
+type Partitioned interface {
+	PartitionKey(data channel.Message) string
+}
+
+// Parameterized
+// An optional interface of a Cluster that declares the runtime parameters it accepts. The
+// parameters a supervisor is provisioned with are validated against the declared schema.
+type Parameterized interface {
+	Parameters() []ParameterSpec
+}
+
+// SetupHook
+// An optional interface of a Cluster, Setup is called once per run before any stage starts, such
+// as to open a connection the stages share. A run whose setup fails is stopped before any stage
+// starts and the error is reported in the response.
+type SetupHook interface {
+	Setup(ctx context.Context) error
+}
+
+// TeardownHook
+// An optional interface of a Cluster, Teardown is called once per run after every stage has
+// returned, whether the run completed, crashed or was cancelled. It is not called if setup failed.
+type TeardownHook interface {
+	Teardown(ctx context.Context) error
+}
+
+// WorkerHook
+// An optional interface of a Cluster, SetupWorker is called by every goroutine before it runs
+// its stage. A goroutine whose setup fails is handled as if it panicked, following on-worker-panic.
+type WorkerHook interface {
+	SetupWorker(ctx context.Context, stage string) error
+}
+
+// FailureHook is an optional interface of a Cluster, OnFailure is called when a run crashes or its setup fails
+type FailureHook interface {
+	OnFailure(ctx context.Context, response *Response)
+}
+
+// Hooks are the lifecycle hooks of a cluster, a hook that is nil is not called
+type Hooks struct {
+	Setup       func(ctx context.Context) error
+	Teardown    func(ctx context.Context) error
+	SetupWorker func(ctx context.Context, stage string) error
+	OnFailure   func(ctx context.Context, response *Response)
+}
+
+// Parameters are the runtime parameters a supervisor was provisioned with, such as a date range or tenant
+type Parameters map[string]any
+
+type ParameterType string
+
+const (
+	StringParameter ParameterType = "string"
+	IntParameter    ParameterType = "int"
+	FloatParameter  ParameterType = "float"
+	BoolParameter   ParameterType = "bool"
+	TimeParameter   ParameterType = "time" // an RFC 3339 timestamp or a yyyy-mm-dd date
+)
+
+type ParameterSpec struct {
+	Name        string        `json:"name"`
+	Type        ParameterType `json:"type"`
+	Required    bool          `json:"required,omitempty"`
+	Default     any           `json:"default,omitempty"` // used when the parameter is not given
+	Description string        `json:"description,omitempty"`
+}
+
+type ExtractStage func(ctx context.Context, output channel.OutputChannel)
+
+type TransformStage func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel)
+
+type LoadStage func(ctx context.Context, input channel.InputChannel)
+
+// StageConfig
+// Tunes a single stage of a pipeline, the threshold, growth factor and capacity are those of
+// the channel the stage pulls from and are ignored for the extract stage. A transform or load
+// stage with a PartitionBy key runs partitioned, where the data units of a key are only ever
+// handled by one of its goroutines at a time.
+type StageConfig struct {
+	Threshold    int     `json:"threshold"`
+	GrowthFactor int     `json:"growth-factor"`
+	Capacity     int     `json:"capacity,omitempty"`
+	StartWith    int     `json:"start-with"`
+	MinRoutines  int     `json:"min-routines,omitempty"`
+	MaxRoutines  int     `json:"max-routines,omitempty"`
+	PartitionBy  KeyFunc `json:"-"`
+}
+
+type Stage struct {
+	Name    string      `json:"name"`
+	Segment Segment     `json:"segment"`
+	Config  StageConfig `json:"config"`
+
+	run TransformStage // extract stages are given no input, load stages no output
+}
+
+type FanOut int8
+
+const (
+	Broadcast FanOut = 0 // every data unit is pushed to every load stage
+	ByKey            = 1 // every data unit is pushed to the load stage chosen by its key
+)
+
+// KeyFunc returns the key a data unit is routed by, a key matching the name of a load stage
+// is routed to that stage and any other key is hashed to one of the load stages
+type KeyFunc func(data channel.Message) string
+
+// Pipeline
+// A cluster made of named stages connected by managed channels, where every stage scales
+// independently. A Pipeline starts with one or more extract stages whose data is merged
+// into the transform stages, and ends with one or more load stages that the transformed
+// data is fanned out to.
+type Pipeline struct {
+	extracts   []*Stage
+	transforms []*Stage
+	loads      []*Stage
+
+	fanOut     FanOut
+	key        KeyFunc
+	parameters []ParameterSpec
+	hooks      Hooks
+}
+
+// RetryPolicy is the retry section of a Config with the defaults applied
+type RetryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Jitter      float64
+	RetryOn     []string
+}
+
+// Retrier runs an operation of a stage again when it fails, following the retry policy of the cluster
+type Retrier interface {
+	Do(ctx context.Context, data channel.Message, operation func(ctx context.Context) error) error
+}
+
+// Logger writes to the log of the supervisor a stage runs under
+type Logger interface {
+	Log(message string)
+	Warning(message string)
+	Fatal(message string)
+}
+
+// Cache holds data for a limited time so it can be handed between the clusters of a chain
+type Cache interface {
+	Save(data any) (identifier string, success bool)
+	Load(identifier string) (data any, success bool)
+}
+
+// MetricRecorder records the custom metrics in the statistics of a supervisor
+type MetricRecorder interface {
+	Add(name string, delta int64)       // adds the delta to a counter
+	Set(name string, value float64)     // sets a gauge to the value
+	Observe(name string, value float64) // adds the value to a histogram
+}
+
+// OutputRecorder records the outputs of a run, a workflow hands them to the clusters downstream of it
+type OutputRecorder interface {
+	Output(name string, value any)
+}
+
+// Run
+// Describes the supervisor a stage runs under and is handed to every stage through its context.
+// The logger, cache and metrics are scoped to the supervisor, so what a stage logs or counts is
+// attributed to the run without the stage having to name its cluster.
+type Run struct {
+	Supervisor uint64
+	Cluster    string // the identifier the cluster was registered under
+	Config     string // the identifier of the config the supervisor runs with
+	Attempt    int
+	Parameters Parameters
+
+	Logger  Logger
+	Cache   Cache
+	Metrics MetricRecorder
+	Outputs OutputRecorder
+}
+
 type Config struct {
-	Identifier                  string  `json:"identifier"`
-	Mode                        OnCrash `json:"on-crash"`
-	StartWithNTransformClusters int     `json:"start-with-n-t-channels"`
-	StartWithNLoadClusters      int     `json:"start-with-n-l-channels"`
-	ETChannelThreshold          int     `json:"et-channel-threshold"`
-	ETChannelGrowthFactor       int     `json:"et-channel-growth-factor"`
-	TLChannelThreshold          int     `json:"tl-channel-threshold"`
-	TLChannelGrowthFactor       int     `json:"tl-channel-growth-factor"`
+	Identifier                  string        `json:"identifier"`
+	Mode                        *OnCrash      `json:"on-crash,omitempty"`
+	StartWithNTransformClusters int           `json:"start-with-n-t-channels"`
+	StartWithNLoadClusters      int           `json:"start-with-n-l-channels"`
+	ETChannelThreshold          int           `json:"et-channel-threshold"`
+	ETChannelGrowthFactor       int           `json:"et-channel-growth-factor"`
+	TLChannelThreshold          int           `json:"tl-channel-threshold"`
+	TLChannelGrowthFactor       int           `json:"tl-channel-growth-factor"`
+	ETChannelCapacity           int           `json:"et-channel-capacity,omitempty"`
+	TLChannelCapacity           int           `json:"tl-channel-capacity,omitempty"`
+	MaxRuntime                  float64       `json:"max-runtime,omitempty"` // minutes, 0 means no deadline
+	MaxRestarts                 int           `json:"max-restarts,omitempty"`
+	RestartBackoff              float64       `json:"restart-backoff,omitempty"`     // seconds, doubles every restart
+	MaxRestartBackoff           float64       `json:"max-restart-backoff,omitempty"` // seconds
+	RestartWindow               float64       `json:"restart-window,omitempty"`      // minutes, 0 counts every restart
+	OnWorkerPanic               OnWorkerPanic `json:"on-worker-panic"`
+	MaxWorkerReplacements       int           `json:"max-worker-replacements,omitempty"`
+	ReplaceExtractWorkers       bool          `json:"replace-extract-workers,omitempty"` // a replaced extract starts over, so data units may be pushed at least once
+	MinTransformRoutines        int           `json:"min-transform-routines,omitempty"`
+	MaxTransformRoutines        int           `json:"max-transform-routines,omitempty"`
+	MinLoadRoutines             int           `json:"min-load-routines,omitempty"`
+	MaxLoadRoutines             int           `json:"max-load-routines,omitempty"`
+	ScaleDownCooldown           float64       `json:"scale-down-cooldown,omitempty"`      // seconds a channel must stay empty before scaling in
+	ScalingPolicy               string        `json:"scaling-policy,omitempty"`           // threshold, linear, target-depth, throughput or a registered policy
+	MonitorRefreshDuration      float64       `json:"monitor-refresh-duration,omitempty"` // seconds between scaling decisions
+	ScalingStep                 int           `json:"scaling-step,omitempty"`             // goroutines added or removed by the linear policy
+	TargetDepth                 int           `json:"target-depth,omitempty"`             // data units the target-depth policy keeps waiting in a channel
+	TargetThroughput            float64       `json:"target-throughput,omitempty"`        // data units a second one goroutine handles under the throughput policy
+	RetryMaxAttempts            int           `json:"retry-max-attempts,omitempty"`       // attempts at an operation passed to Retry, 0 means a single attempt
+	RetryBackoff                float64       `json:"retry-backoff,omitempty"`            // seconds, doubles every attempt
+	RetryMaxBackoff             float64       `json:"retry-max-backoff,omitempty"`        // seconds
+	RetryJitter                 float64       `json:"retry-jitter,omitempty"`             // fraction of the backoff that is randomised, negative for none
+	RetryOn                     []string      `json:"retry-on,omitempty"`                 // errors containing any of these are retried, empty retries every error
+	Ordered                     bool          `json:"ordered,omitempty"`                  // load stages receive data units in the order the extract stages pushed them
+	ReorderBufferSize           int           `json:"reorder-buffer-size,omitempty"`      // data units the ordered mode holds while waiting for an earlier one
 }
 
 type Statistics struct {
-	NumProvisionedExtractRoutines int `json:"num-provisioned-extract-routines"`
-	NumProvisionedTransformRoutes int `json:"num-provisioned-transform-routes"`
-	NumProvisionedLoadRoutines    int `json:"num-provisioned-load-routines"`
-	NumEtThresholdBreaches        int `json:"num-et-threshold-breaches"`
-	NumTlThresholdBreaches        int `json:"num-tl-threshold-breaches"`
+	NumProvisionedExtractRoutines int               `json:"num-provisioned-extract-routines"`
+	NumProvisionedTransformRoutes int               `json:"num-provisioned-transform-routes"`
+	NumProvisionedLoadRoutines    int               `json:"num-provisioned-load-routines"`
+	NumEtThresholdBreaches        int               `json:"num-et-threshold-breaches"`
+	NumTlThresholdBreaches        int               `json:"num-tl-threshold-breaches"`
+	TerminatedByDeadline          bool              `json:"terminated-by-deadline"`
+	NumRestarts                   int               `json:"num-restarts"`
+	NumWorkerPanics               int               `json:"num-worker-panics"`
+	NumReplacedWorkers            int               `json:"num-replaced-workers"`
+	NumPanickedRecords            int               `json:"num-panicked-records"` // held by a goroutine when it panicked, they are not passed on
+	ETChannel                     channel.Metrics   `json:"et-channel"`
+	TLChannel                     channel.Metrics   `json:"tl-channel"`
+	Restarts                      []RestartAttempt  `json:"restarts,omitempty"`
+	NumScaleUps                   int               `json:"num-scale-ups"`
+	NumScaleDowns                 int               `json:"num-scale-downs"`
+	ScaleEvents                   []ScaleEvent      `json:"scale-events,omitempty"`
+	Stages                        []StageStatistics `json:"stages,omitempty"`
+	NumRejected                   int               `json:"num-rejected"`
+	NumRetries                    int               `json:"num-retries"`
+	NumRetryFailures              int               `json:"num-retry-failures"`
+	ReorderBufferSize             int               `json:"reorder-buffer-size,omitempty"`
+	ReorderBufferOccupancy        int               `json:"reorder-buffer-occupancy,omitempty"` // data units waiting for an earlier one to be released
+	ReorderBufferHighWaterMark    int               `json:"reorder-buffer-high-water-mark,omitempty"`
+	Metrics                       Metrics           `json:"metrics"` // recorded by the stages through their run
+}
+
+// Metrics
+// The custom metrics the stages of a supervisor recorded, such as rows read, bytes written or
+// api calls made. A counter only ever grows, a gauge holds the value last set and a histogram
+// counts the observed values that fall into each of its buckets.
+type Metrics struct {
+	Counters   map[string]int64      `json:"counters,omitempty"`
+	Gauges     map[string]float64    `json:"gauges,omitempty"`
+	Histograms map[string]*Histogram `json:"histograms,omitempty"`
+}
+
+type Histogram struct {
+	Count   int64     `json:"count"`
+	Sum     float64   `json:"sum"`
+	Min     float64   `json:"min"`
+	Max     float64   `json:"max"`
+	Buckets []float64 `json:"buckets"` // the upper bound of each bucket, the last bucket has no upper bound
+	Counts  []int64   `json:"counts"`  // one more than the bounds, the values observed in each bucket
+}
+
+type StageStatistics struct {
+	Name                 string          `json:"name"`
+	Segment              Segment         `json:"segment"`
+	NumProvisioned       int             `json:"num-provisioned"`
+	NumThresholdBreaches int             `json:"num-threshold-breaches"`
+	NumRejected          int             `json:"num-rejected"`
+	NumRetries           int             `json:"num-retries"`
+	NumRetryFailures     int             `json:"num-retry-failures"`
+	Input                channel.Metrics `json:"input"`
+	Output               channel.Metrics `json:"output"` // only reported for extract stages that fan in
+	Finished             bool            `json:"finished"`
+	Partitions           int             `json:"partitions,omitempty"`     // goroutines a partitioned stage routes keys to
+	NumRebalances        int             `json:"num-rebalances,omitempty"` // times the keys of a partitioned stage were redistributed
+}
+
+type RestartAttempt struct {
+	Attempt   int           `json:"attempt"`
+	CrashedAt time.Time     `json:"crashed-at"`
+	Backoff   time.Duration `json:"backoff"`
+}
+
+// ScaleEvent records a change to the number of goroutines provisioned for a segment
+type ScaleEvent struct {
+	Stage     string    `json:"stage"`
+	Segment   Segment   `json:"segment"`
+	From      int       `json:"from"`
+	To        int       `json:"to"`
+	Reason    string    `json:"reason"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 type Status uint8
@@ -66,8 +368,15 @@ const (
 )
 
 type Response struct {
-	Config     Config        `json:"config"`
-	Stats      *Statistics   `json:"stats""`
-	LapsedTime time.Duration `json:"lapsed-time"`
-	DidItCrash bool          `json:"crashed"`
+	Config           Config         `json:"config"`
+	Stats            *Statistics    `json:"stats""`
+	LapsedTime       time.Duration  `json:"lapsed-time"`
+	DidItCrash       bool           `json:"crashed"`
+	Cancelled        bool           `json:"cancelled"`
+	DeadlineExceeded bool           `json:"deadline-exceeded,omitempty"` // the run was cancelled because its max-runtime passed, not by an operator
+	Parameters       Parameters     `json:"parameters,omitempty"`
+	Outputs          map[string]any `json:"outputs,omitempty"` // recorded by the stages for the clusters downstream of the run
+
+	SetupError    string `json:"setup-error,omitempty"` // the run was stopped before any stage started
+	TeardownError string `json:"teardown-error,omitempty"`
 }
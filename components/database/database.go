@@ -50,7 +50,7 @@ func (db *Database) StoreUsageRecord(identifier string, data *cluster.Statistics
 	record.mutex.Lock()
 
 	record.Head++
-	entry := Entry{time.Now(), elpased, *data} //	make a copy of the stats
+	entry := Entry{time.Now(), elpased, *data.Copy()} //	make a copy of the stats
 	record.Entries[record.Head] = entry
 
 	record.mutex.Unlock()
@@ -0,0 +1,97 @@
+package deadletter
+
+import "time"
+
+func NewStore(maxAllowedRecords ...int) *Store {
+	store := new(Store)
+
+	store.records = make([]*Record, 0)
+	store.maxAllowedRecords = DefaultMaxAllowedRecords
+	if (len(maxAllowedRecords) == 1) && (maxAllowedRecords[0] > 0) {
+		store.maxAllowedRecords = maxAllowedRecords[0]
+	}
+
+	return store
+}
+
+// Add stores a copy of the record and returns the id it was given
+func (store *Store) Add(record Record) uint64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if len(store.records) == store.maxAllowedRecords {
+		store.records = store.records[1:]
+		store.numOfDropped++
+	}
+
+	store.idReference++
+	record.Id = store.idReference
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+
+	store.records = append(store.records, &record)
+	return record.Id
+}
+
+// List returns a copy of every record in the order they were rejected
+func (store *Store) List() []Record {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	records := make([]Record, len(store.records))
+	for i, record := range store.records {
+		records[i] = *record
+	}
+	return records
+}
+
+func (store *Store) Get(id uint64) (Record, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	for _, record := range store.records {
+		if record.Id == id {
+			return *record, true
+		}
+	}
+	return Record{}, false
+}
+
+func (store *Store) Remove(id uint64) (Record, bool) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for i, record := range store.records {
+		if record.Id == id {
+			store.records = append(store.records[:i], store.records[i+1:]...)
+			return *record, true
+		}
+	}
+	return Record{}, false
+}
+
+// Purge removes every record from the store and returns how many were removed
+func (store *Store) Purge() int {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	n := len(store.records)
+	store.records = make([]*Record, 0)
+	return n
+}
+
+func (store *Store) Size() int {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return len(store.records)
+}
+
+// NumOfDropped returns how many records were dropped because the store was full
+func (store *Store) NumOfDropped() uint64 {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.numOfDropped
+}
@@ -0,0 +1,44 @@
+package deadletter
+
+import "testing"
+
+func TestStoreEvictsOldest(t *testing.T) {
+	store := NewStore()
+	for i := 0; i < DefaultMaxAllowedRecords+2; i++ {
+		store.Add(Record{Cluster: "multiply", Data: i})
+	}
+
+	// the default cap is 10000, the two oldest records make room for the newest
+	records := store.List()
+	if (store.Size() != 10000) || (store.NumOfDropped() != 2) {
+		t.Fatalf("expected 10000 records and 2 dropped, got %d and %d", store.Size(), store.NumOfDropped())
+	}
+	if (records[0].Id != 3) || (records[0].Data != 2) || (records[len(records)-1].Id != DefaultMaxAllowedRecords+2) {
+		t.Errorf("expected the oldest records to be evicted first, got ids %d through %d", records[0].Id, records[len(records)-1].Id)
+	}
+	if _, found := store.Get(1); found {
+		t.Error("expected an evicted record to be gone")
+	}
+}
+
+func TestStoreRemoveAndPurge(t *testing.T) {
+	store := NewStore(2)
+	first := store.Add(Record{Stage: "evens", Error: "odd number", Data: 1})
+	store.Add(Record{Stage: "evens", Error: "odd number", Data: 3})
+
+	if record, found := store.Get(first); !found || (record.Data != 1) || record.Timestamp.IsZero() {
+		t.Errorf("expected the record to be stored with a timestamp, got %+v", record)
+	}
+	if _, found := store.Remove(first); !found || (store.Size() != 1) {
+		t.Errorf("expected the record to be removed, %d remain", store.Size())
+	}
+	if _, found := store.Remove(first); found {
+		t.Error("expected a record to only be removed once")
+	}
+
+	// a store that was drained below its cap does not drop records
+	store.Add(Record{Data: 5})
+	if (store.NumOfDropped() != 0) || (store.Purge() != 2) || (store.Size() != 0) {
+		t.Errorf("expected the 2 records to be purged without any dropped, got %d dropped", store.NumOfDropped())
+	}
+}
@@ -0,0 +1,36 @@
+package deadletter
+
+import (
+	"github.com/GabeCordo/etl/components/channel"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxAllowedRecords = 0x2710 // the default maximum is 10000
+)
+
+// Record is a data unit a stage rejected, along with why and where it was rejected
+type Record struct {
+	Id         uint64          `json:"id"`
+	Cluster    string          `json:"cluster"`
+	Supervisor uint64          `json:"supervisor"`
+	Stage      string          `json:"stage"`
+	Error      string          `json:"error"`
+	Data       channel.Message `json:"data"`
+	Timestamp  time.Time       `json:"timestamp"`
+}
+
+// Store
+// Holds the dead-lettered records of a single cluster in the order they were rejected. When the
+// store is full the oldest record is dropped to make room, so a cluster that rejects everything
+// cannot take memory away from the rest of the node.
+type Store struct {
+	records []*Record
+
+	maxAllowedRecords int
+	numOfDropped      uint64
+	idReference       uint64
+
+	mutex sync.RWMutex
+}
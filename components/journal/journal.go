@@ -0,0 +1,260 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Open
+// Replays the journal at the path, creating it if it does not exist. A record torn by the node
+// stopping part way through writing it ends the replay, and the journal is compacted so that
+// only whole records remain.
+func Open(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	journal := new(Journal)
+	journal.path = path
+	journal.entries = make(map[uint64]*Entry)
+
+	if err := journal.replay(); err != nil {
+		return nil, err
+	}
+
+	journal.recovered = make([]Entry, 0)
+	for _, entry := range journal.sorted() {
+		if (entry.State == Pending) || (entry.State == Running) {
+			journal.recovered = append(journal.recovered, *entry)
+		}
+	}
+
+	if err := journal.compact(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func (journal *Journal) replay() error {
+	file, err := os.Open(journal.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// a last line without a newline was never synced as a whole
+			return nil
+		}
+
+		entry := new(Entry)
+		if json.Unmarshal(line, entry) != nil {
+			return nil
+		}
+		journal.entries[entry.Id] = entry
+		if entry.Id > journal.counter {
+			journal.counter = entry.Id
+		}
+	}
+}
+
+// Recovered returns the runs that had not finished when the journal was opened, in the order they were accepted
+func (journal *Journal) Recovered() []Entry {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	return append([]Entry(nil), journal.recovered...)
+}
+
+// Enqueue records a run the provisioner accepted as pending, returning the id it is journaled under
+func (journal *Journal) Enqueue(entry Entry) (uint64, error) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	journal.counter++
+	entry.Id = journal.counter
+	entry.State = Pending
+	entry.Enqueued = time.Now()
+
+	return entry.Id, journal.write(&entry)
+}
+
+// Resume records a recovered run as pending again under the supervisor it was provisioned as
+func (journal *Journal) Resume(id uint64, supervisor uint64) error {
+	return journal.update(id, func(entry *Entry) {
+		entry.State = Pending
+		entry.Supervisor = supervisor
+		entry.Recoveries++
+		entry.Error = ""
+	})
+}
+
+// Started records that the run was admitted and its supervisor started
+func (journal *Journal) Started(id uint64) error {
+	return journal.update(id, func(entry *Entry) {
+		entry.State = Running
+	})
+}
+
+// Finish records how the run ended
+func (journal *Journal) Finish(id uint64, state State, description string) error {
+	return journal.update(id, func(entry *Entry) {
+		entry.State = state
+		entry.Error = description
+	})
+}
+
+func (journal *Journal) update(id uint64, change func(entry *Entry)) error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	existing, found := journal.entries[id]
+	if !found {
+		return fmt.Errorf("no run journaled under %d", id)
+	}
+
+	entry := *existing
+	change(&entry)
+	return journal.write(&entry)
+}
+
+// write appends the entry and syncs it to the file before it replaces the entry in memory, the mutex must be held
+func (journal *Journal) write(entry *Entry) error {
+	if journal.file == nil {
+		return errors.New("the journal is closed")
+	}
+
+	entry.Updated = time.Now()
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if _, err := journal.file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	if err := journal.file.Sync(); err != nil {
+		return err
+	}
+	journal.entries[entry.Id] = entry
+
+	journal.appended++
+	if journal.appended >= CompactAfter {
+		return journal.compact()
+	}
+	return nil
+}
+
+// compact
+// Rewrites the journal with a single record for every run that has not finished and the most
+// recent finished runs. The new journal is synced before it replaces the old one, so the node
+// stopping part way through leaves one or the other. The mutex must be held.
+func (journal *Journal) compact() error {
+	entries := journal.sorted()
+
+	finished := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if (entries[i].State == Pending) || (entries[i].State == Running) {
+			continue
+		}
+		finished++
+		if finished > MaxFinishedEntries {
+			delete(journal.entries, entries[i].Id)
+		}
+	}
+
+	temporary := journal.path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, entry := range journal.sorted() {
+		bytes, err := json.Marshal(entry)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(bytes, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if journal.file != nil {
+		journal.file.Close()
+		journal.file = nil
+	}
+	renamed := os.Rename(temporary, journal.path)
+
+	// the old journal is appended to again if it could not be replaced
+	journal.file, err = os.OpenFile(journal.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	journal.appended = 0
+	if renamed != nil {
+		return renamed
+	}
+	return err
+}
+
+// sorted returns the entries in the order they were accepted, the mutex must be held
+func (journal *Journal) sorted() []*Entry {
+	entries := make([]*Entry, 0, len(journal.entries))
+	for _, entry := range journal.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Id < entries[j].Id })
+
+	return entries
+}
+
+func (journal *Journal) Get(id uint64) (Entry, bool) {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if entry, found := journal.entries[id]; found {
+		return *entry, true
+	}
+	return Entry{}, false
+}
+
+// List returns every run in the journal, newest first
+func (journal *Journal) List() []Entry {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	sorted := journal.sorted()
+	entries := make([]Entry, len(sorted))
+	for i, entry := range sorted {
+		entries[len(sorted)-1-i] = *entry
+	}
+	return entries
+}
+
+// Close stops the journal from accepting any more records
+func (journal *Journal) Close() error {
+	journal.mutex.Lock()
+	defer journal.mutex.Unlock()
+
+	if journal.file == nil {
+		return nil
+	}
+	err := journal.file.Close()
+	journal.file = nil
+	return err
+}
@@ -0,0 +1,100 @@
+package journal
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "runs", "etl.journal")
+
+	journal, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restart := cluster.Restart
+	completed, _ := journal.Enqueue(Entry{Cluster: "multiply", Supervisor: 1})
+	running, _ := journal.Enqueue(Entry{Cluster: "multiply", Supervisor: 2, OnCrash: &restart})
+	pending, _ := journal.Enqueue(Entry{Cluster: "vector", Supervisor: 3, Parameters: cluster.Parameters{"limit": 5}, Priority: 2})
+
+	journal.Started(completed)
+	journal.Finish(completed, Completed, "")
+	journal.Started(running)
+	if err := journal.Finish(42, Failed, ""); err == nil {
+		t.Error("expected a run that was never journaled to be rejected")
+	}
+
+	// the node stops part way through writing a record, without closing the journal
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(`{"id": 3, "state": "comp`))
+	file.Close()
+
+	journal, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	recovered := journal.Recovered()
+	if (len(recovered) != 2) || (recovered[0].Id != running) || (recovered[0].State != Running) || (recovered[1].Id != pending) || (recovered[1].State != Pending) {
+		t.Fatalf("expected the running and pending runs to be recovered, got %+v", recovered)
+	}
+	if limit, _ := recovered[1].Parameters.Int("limit"); (limit != 5) || (recovered[1].Priority != 2) || (recovered[0].OnCrash == nil) || (*recovered[0].OnCrash != cluster.Restart) {
+		t.Errorf("expected the request to be recovered as it was accepted, got %+v", recovered[1])
+	}
+	if entry, _ := journal.Get(completed); entry.State != Completed {
+		t.Errorf("expected the completed run to stay completed, got %s", entry.State)
+	}
+
+	// new runs continue from the last id, and the recovered runs are journaled as they are picked back up
+	if id, _ := journal.Enqueue(Entry{Cluster: "multiply"}); id != 4 {
+		t.Errorf("expected the next run to be journaled under 4, got %d", id)
+	}
+	journal.Finish(running, Interrupted, "the node stopped")
+	journal.Resume(pending, 7)
+
+	if entry, _ := journal.Get(pending); (entry.State != Pending) || (entry.Supervisor != 7) || (entry.Recoveries != 1) {
+		t.Errorf("expected the run to be resumed, got %+v", entry)
+	}
+	if entries := journal.List(); (len(entries) != 4) || (entries[0].Id != 4) {
+		t.Errorf("expected every run newest first, got %+v", entries)
+	}
+}
+
+func TestJournalCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "etl.journal")
+
+	journal, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unfinished, _ := journal.Enqueue(Entry{Cluster: "multiply"})
+	for i := 0; i < MaxFinishedEntries+10; i++ {
+		id, _ := journal.Enqueue(Entry{Cluster: "multiply"})
+		if err := journal.Finish(id, Completed, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close()
+
+	journal, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+
+	entries := journal.List()
+	if len(entries) != MaxFinishedEntries+1 {
+		t.Errorf("expected the oldest finished runs to be compacted away, got %d runs", len(entries))
+	}
+	if recovered := journal.Recovered(); (len(recovered) != 1) || (recovered[0].Id != unfinished) {
+		t.Errorf("expected the unfinished run to survive compaction, got %+v", recovered)
+	}
+}
@@ -0,0 +1,57 @@
+package journal
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	MaxFinishedEntries = 1000 // finished runs kept when the journal is compacted, the oldest are dropped first
+	CompactAfter       = 4096 // records appended before the journal is compacted again
+)
+
+// State is where a run is at, as it was last recorded in the journal
+type State string
+
+const (
+	Pending     State = "pending" // accepted by the provisioner, waiting to be admitted
+	Running     State = "running"
+	Completed   State = "completed"
+	Failed      State = "failed"
+	Cancelled   State = "cancelled"
+	Interrupted State = "interrupted" // running when the node stopped, and not run again because of the crash policy of its config
+)
+
+// Entry is a run accepted by the provisioner, every change to it is appended to the journal as a whole
+type Entry struct {
+	Id         uint64             `json:"id"`
+	Cluster    string             `json:"cluster"`
+	Config     string             `json:"config,omitempty"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"` // as they were given, they are validated again when the run is recovered
+	Priority   int                `json:"priority,omitempty"`
+	OnCrash    *cluster.OnCrash   `json:"on-crash,omitempty"`
+	State      State              `json:"state"`
+	Supervisor uint64             `json:"supervisor,omitempty"` // of the latest attempt, supervisors do not outlive the node
+	Recoveries int                `json:"recoveries,omitempty"` // times the run was picked back up after the node restarted
+	Error      string             `json:"error,omitempty"`
+	Enqueued   time.Time          `json:"enqueued"`
+	Updated    time.Time          `json:"updated"`
+}
+
+// Journal
+// A write-ahead store of the runs accepted by the provisioner. Every change to a run is appended
+// and synced to the file before it is acknowledged, and the file is replayed when it is opened so
+// the runs that had not finished when the node stopped can be picked back up.
+type Journal struct {
+	path     string
+	file     *os.File
+	entries  map[uint64]*Entry
+	counter  uint64
+	appended int // records appended since the journal was last compacted
+
+	recovered []Entry // the runs that had not finished when the journal was opened
+
+	mutex sync.Mutex
+}
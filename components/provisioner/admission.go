@@ -0,0 +1,213 @@
+package provisioner
+
+import (
+	"github.com/GabeCordo/etl/components/supervisor"
+	"sort"
+	"time"
+)
+
+// SetLimit sets how many supervisors can run at once across every cluster, supervisor.MaxConcurrentSupervisors if not positive
+func (provisioner *Provisioner) SetLimit(limit int) {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	if limit <= 0 {
+		limit = supervisor.MaxConcurrentSupervisors
+	}
+	provisioner.admission.limit = limit
+	provisioner.dispatch()
+}
+
+// SetClusterLimit sets how many supervisors of the cluster can run at once, zero removes the limit
+func (provisioner *Provisioner) SetClusterLimit(identifier string, limit int) {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	if limit > 0 {
+		provisioner.admission.clusterLimits[identifier] = limit
+	} else {
+		delete(provisioner.admission.clusterLimits, identifier)
+	}
+	provisioner.dispatch()
+}
+
+// Admit
+// Blocks until the supervisor is allowed to run, queueing it while the node or its cluster is
+// running as many supervisors as it is allowed. A supervisor with a higher priority is admitted
+// first, and supervisors of the same priority in the order they were queued. Only an Admitted
+// supervisor may run, and it must be released once it completes.
+func (provisioner *Provisioner) Admit(identifier string, supervisorInstance *supervisor.Supervisor, priority int) Admittance {
+	registry, found := provisioner.GetRegistry(identifier)
+	if !found {
+		return Unregistered
+	}
+
+	a := &provisioner.admission
+	a.mutex.Lock()
+
+	if a.closed {
+		a.mutex.Unlock()
+		return Withdrawn
+	}
+
+	t := &ticket{
+		cluster:    identifier,
+		registry:   registry,
+		supervisor: supervisorInstance,
+		priority:   priority,
+		enqueued:   time.Now(),
+		decided:    make(chan struct{}),
+	}
+	position := sort.Search(len(a.queue), func(i int) bool { return a.queue[i].priority < priority })
+	a.queue = append(a.queue, nil)
+	copy(a.queue[position+1:], a.queue[position:])
+	a.queue[position] = t
+
+	provisioner.dispatch()
+	select {
+	case <-t.decided:
+		a.mutex.Unlock()
+		return t.outcome
+	default:
+	}
+
+	a.numQueued++
+	supervisorInstance.Event(supervisor.Queue)
+	a.mutex.Unlock()
+
+	select {
+	case <-t.decided:
+		return t.outcome
+	case <-supervisorInstance.Context().Done():
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	for i, queued := range a.queue {
+		if queued == t {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			a.numAbandoned++
+			return Abandoned
+		}
+	}
+	// the supervisor left the queue as it was stopped, an admitted supervisor still holds a slot until it is released
+	return t.outcome
+}
+
+// Withdraw
+// Stops admitting supervisors for good, every supervisor still queued leaves the queue as
+// Withdrawn without running, and so does any supervisor that asks to be admitted afterwards.
+func (provisioner *Provisioner) Withdraw() {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	provisioner.admission.closed = true
+	for _, t := range provisioner.admission.queue {
+		t.outcome = Withdrawn
+		close(t.decided)
+	}
+	provisioner.admission.queue = nil
+}
+
+// Release frees the slot an admitted supervisor held, admitting whoever is next
+func (provisioner *Provisioner) Release(identifier string) {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	if registry, found := provisioner.GetRegistry(identifier); found {
+		registry.Release()
+	}
+	if provisioner.admission.active > 0 {
+		provisioner.admission.active--
+	}
+	provisioner.dispatch()
+}
+
+// dispatch admits queued supervisors in order while the node has slots free, a supervisor whose
+// cluster is at its limit is passed over so it does not hold back the clusters behind it, the mutex must be held
+func (provisioner *Provisioner) dispatch() {
+	a := &provisioner.admission
+
+	for i := 0; !a.closed && (i < len(a.queue)) && (a.active < a.limit); {
+		t := a.queue[i]
+		if !t.registry.Acquire(a.clusterLimits[t.cluster]) {
+			i++
+			continue
+		}
+
+		a.queue = append(a.queue[:i], a.queue[i+1:]...)
+		a.active++
+		a.numAdmitted++
+		a.waits.Observe(time.Now().Sub(t.enqueued).Seconds())
+		t.outcome = Admitted
+		close(t.decided)
+	}
+}
+
+// Queue returns the supervisors waiting to be admitted in the order they will be considered
+func (provisioner *Provisioner) Queue() []QueueEntry {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	now := time.Now()
+	entries := make([]QueueEntry, len(provisioner.admission.queue))
+	for i, t := range provisioner.admission.queue {
+		entries[i] = QueueEntry{
+			Cluster:    t.cluster,
+			Supervisor: t.supervisor.Id,
+			Priority:   t.priority,
+			Position:   i + 1,
+			Enqueued:   t.enqueued,
+			Waiting:    now.Sub(t.enqueued),
+		}
+	}
+
+	return entries
+}
+
+// Position returns where the supervisor is in the queue, false if it is not queued
+func (provisioner *Provisioner) Position(identifier string, supervisorId uint64) (QueueEntry, bool) {
+	for _, entry := range provisioner.Queue() {
+		if (entry.Cluster == identifier) && (entry.Supervisor == supervisorId) {
+			return entry, true
+		}
+	}
+	return QueueEntry{}, false
+}
+
+// AdmissionMetrics returns the limits, how many supervisors are running and queued, and how long they waited
+func (provisioner *Provisioner) AdmissionMetrics() AdmissionMetrics {
+	provisioner.admission.mutex.Lock()
+	defer provisioner.admission.mutex.Unlock()
+
+	a := &provisioner.admission
+	waits := *a.waits
+	waits.Buckets = append([]float64(nil), a.waits.Buckets...)
+	waits.Counts = append([]int64(nil), a.waits.Counts...)
+
+	metrics := AdmissionMetrics{
+		Limit:        a.limit,
+		Active:       a.active,
+		Queued:       len(a.queue),
+		NumAdmitted:  a.numAdmitted,
+		NumQueued:    a.numQueued,
+		NumAbandoned: a.numAbandoned,
+		Waits:        &waits,
+		Clusters:     make(map[string]ClusterAdmission),
+	}
+
+	for _, pair := range provisioner.GetRegistries() {
+		metrics.Clusters[pair.Identifier] = ClusterAdmission{
+			Limit:  a.clusterLimits[pair.Identifier],
+			Active: pair.Registry.NumOfActiveSupervisors(),
+		}
+	}
+	for _, t := range a.queue {
+		clusterAdmission := metrics.Clusters[t.cluster]
+		clusterAdmission.Queued++
+		metrics.Clusters[t.cluster] = clusterAdmission
+	}
+
+	return metrics
+}
@@ -10,6 +10,11 @@ func NewProvisioner() *Provisioner {
 
 	provisioner.Registries = make(map[string]*supervisor.Registry)
 
+	provisioner.admission.limit = supervisor.MaxConcurrentSupervisors
+	provisioner.admission.clusterLimits = make(map[string]int)
+	provisioner.admission.queue = make([]*ticket, 0)
+	provisioner.admission.waits = cluster.NewHistogram()
+
 	return provisioner
 }
 
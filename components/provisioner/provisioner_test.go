@@ -0,0 +1,110 @@
+package provisioner
+
+import (
+	"context"
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/supervisor"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	pipeline := cluster.NewPipeline().
+		Extract("extract", func(ctx context.Context, output channel.OutputChannel) {}).
+		Load("load", func(ctx context.Context, input channel.InputChannel) {})
+
+	provisioner := NewProvisioner()
+	provisioner.Register("a", pipeline)
+	provisioner.Register("b", pipeline)
+	provisioner.SetLimit(2)
+	provisioner.SetClusterLimit("a", 1)
+
+	create := func(identifier string) *supervisor.Supervisor {
+		registry, _ := provisioner.GetRegistry(identifier)
+		return registry.CreateSupervisor()
+	}
+	admit := func(identifier string, supervisorInstance *supervisor.Supervisor, priority int) chan Admittance {
+		admitted := make(chan Admittance, 1)
+		go func() { admitted <- provisioner.Admit(identifier, supervisorInstance, priority) }()
+		return admitted
+	}
+	waitForQueue := func(length int) []QueueEntry {
+		for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+			if queue := provisioner.Queue(); len(queue) == length {
+				return queue
+			}
+		}
+		t.Fatalf("expected %d supervisors to be queued, got %v", length, provisioner.Queue())
+		return nil
+	}
+
+	first := create("a")
+	if provisioner.Admit("a", first, 0) != Admitted {
+		t.Fatal("expected the first supervisor to be admitted")
+	}
+
+	// the cluster is at its limit, but that does not hold back another cluster queued behind it
+	second := create("a")
+	secondAdmitted := admit("a", second, 0)
+	waitForQueue(1)
+	if provisioner.Admit("b", create("b"), 0) != Admitted {
+		t.Fatal("expected a supervisor of another cluster to be admitted")
+	}
+
+	// the node is at its limit, a higher priority is admitted first
+	fourth := create("b")
+	fourthAdmitted := admit("b", fourth, 5)
+	queue := waitForQueue(2)
+	if (queue[0].Supervisor != fourth.Id) || (queue[0].Cluster != "b") || (queue[1].Position != 2) {
+		t.Errorf("expected the higher priority to be first in the queue, got %v", queue)
+	}
+	if second.State != supervisor.Queued {
+		t.Errorf("expected the supervisor to be queued, got %d", second.State)
+	}
+
+	// a supervisor stopped while it is queued gives up its place and never runs
+	stopped := create("a")
+	stoppedAdmitted := admit("a", stopped, 0)
+	waitForQueue(3)
+	stopped.Stop()
+	if <-stoppedAdmitted != Abandoned {
+		t.Error("expected the stopped supervisor not to be admitted")
+	}
+	if response := stopped.Start(); !response.Cancelled || (stopped.State != supervisor.Cancelled) {
+		t.Error("expected the stopped supervisor to finish cancelled")
+	}
+
+	provisioner.Release("b")
+	if <-fourthAdmitted != Admitted {
+		t.Error("expected the higher priority to be admitted once a slot was released")
+	}
+	provisioner.Release("a")
+	if <-secondAdmitted != Admitted {
+		t.Error("expected the supervisor to be admitted once its cluster was released")
+	}
+
+	metrics := provisioner.AdmissionMetrics()
+	if (metrics.Active != 2) || (metrics.NumAdmitted != 4) || (metrics.NumQueued != 3) || (metrics.NumAbandoned != 1) || (metrics.Waits.Count != 4) {
+		t.Errorf("unexpected metrics %+v", metrics)
+	}
+	if clusterA := metrics.Clusters["a"]; (clusterA.Limit != 1) || (clusterA.Active != 1) || (clusterA.Queued != 0) {
+		t.Errorf("unexpected metrics for the cluster %+v", clusterA)
+	}
+
+	// a cluster that is not registered is never admitted, so it cannot run around the limits
+	if provisioner.Admit("c", create("a"), 0) != Unregistered {
+		t.Error("expected a supervisor of an unregistered cluster to be turned away")
+	}
+
+	// once the provisioner stops accepting work the queue is emptied without running anyone
+	waiting := admit("a", create("a"), 0)
+	waitForQueue(1)
+	provisioner.Withdraw()
+	if <-waiting != Withdrawn {
+		t.Error("expected the queued supervisor to be withdrawn")
+	}
+	if provisioner.Admit("b", create("b"), 0) != Withdrawn {
+		t.Error("expected no supervisor to be admitted after the queue was withdrawn")
+	}
+}
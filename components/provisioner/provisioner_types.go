@@ -1,11 +1,80 @@
 package provisioner
 
 import (
+	"github.com/GabeCordo/etl/components/cluster"
 	"github.com/GabeCordo/etl/components/supervisor"
 	"sync"
+	"time"
 )
 
 type Provisioner struct {
 	Registries map[string]*supervisor.Registry `json:"functions"`
 	mutex      sync.RWMutex
+
+	admission admission
+}
+
+// admission holds the supervisors back once the node or their cluster is running as many as it is allowed
+type admission struct {
+	limit         int            // supervisors running at once across every cluster
+	clusterLimits map[string]int // supervisors of a cluster running at once, a cluster without one is only held to the limit
+	active        int
+
+	queue  []*ticket // ordered by priority, then by when the supervisor was queued
+	closed bool      // no supervisor is admitted once the provisioner stops accepting work
+
+	numAdmitted  int
+	numQueued    int
+	numAbandoned int
+	waits        *cluster.Histogram
+
+	mutex sync.Mutex
+}
+
+// ticket is a supervisor waiting to be admitted
+type ticket struct {
+	cluster    string
+	registry   *supervisor.Registry
+	supervisor *supervisor.Supervisor
+	priority   int
+	enqueued   time.Time
+	outcome    Admittance
+	decided    chan struct{} // closed once the supervisor is admitted or withdrawn from the queue
+}
+
+// Admittance is how a supervisor that asked to be admitted left the queue
+type Admittance int8
+
+const (
+	Admitted     Admittance = iota
+	Abandoned               // the supervisor was stopped while it was queued
+	Withdrawn               // the provisioner stopped accepting work while the supervisor was queued
+	Unregistered            // the cluster of the supervisor is not registered
+)
+
+// QueueEntry is a supervisor waiting to be admitted along with where it is in the queue
+type QueueEntry struct {
+	Cluster    string        `json:"cluster"`
+	Supervisor uint64        `json:"supervisor"`
+	Priority   int           `json:"priority"`
+	Position   int           `json:"position"` // 1 is the next to be admitted once its cluster is allowed to run another supervisor
+	Enqueued   time.Time     `json:"enqueued"`
+	Waiting    time.Duration `json:"waiting"`
+}
+
+type ClusterAdmission struct {
+	Limit  int    `json:"limit,omitempty"`
+	Active uint64 `json:"active"`
+	Queued int    `json:"queued"`
+}
+
+type AdmissionMetrics struct {
+	Limit        int                         `json:"limit"`
+	Active       int                         `json:"active"`
+	Queued       int                         `json:"queued"`
+	NumAdmitted  int                         `json:"num-admitted"`
+	NumQueued    int                         `json:"num-queued"`    // supervisors that had to wait to be admitted
+	NumAbandoned int                         `json:"num-abandoned"` // supervisors stopped while they were queued
+	Waits        *cluster.Histogram          `json:"waits"`         // the seconds every admitted supervisor waited
+	Clusters     map[string]ClusterAdmission `json:"clusters"`
 }
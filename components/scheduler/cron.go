@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var dayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// field is the range of values a field of a cron expression accepts
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day-of-month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	{name: "day-of-week", min: 0, max: 7, names: dayNames}, // 7 is also sunday
+}
+
+// ParseCron
+// Parses a five field cron expression (minute hour day-of-month month day-of-week) or one of the
+// descriptors @yearly, @monthly, @weekly, @daily or @hourly. A field is a comma separated list of
+// values, ranges (1-5) or wildcards, each optionally followed by a step (*/15), and the month and
+// day-of-week fields also accept names (jan, mon).
+func ParseCron(spec string) (*Expression, error) {
+	spec = strings.TrimSpace(spec)
+	if expanded, found := descriptors[strings.ToLower(spec)]; found {
+		spec = expanded
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("expected %d fields in the cron expression %q, got %d", len(fields), spec, len(parts))
+	}
+
+	sets := [5]uint64{}
+	for i, part := range parts {
+		set, err := fields[i].parse(part)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	expression := new(Expression)
+	expression.minute = sets[0]
+	expression.hour = sets[1]
+	expression.dayOfMonth = sets[2]
+	expression.month = sets[3]
+	expression.dayOfWeek = sets[4]
+	expression.anyDayOfMonth = strings.HasPrefix(parts[2], "*")
+	expression.anyDayOfWeek = strings.HasPrefix(parts[4], "*")
+
+	// sunday can be written as 0 or 7
+	if expression.dayOfWeek&(1<<7) != 0 {
+		expression.dayOfWeek |= 1
+	}
+
+	return expression, nil
+}
+
+// parse returns the bit set of values matched by a comma separated list
+func (f field) parse(list string) (set uint64, err error) {
+	for _, item := range strings.Split(list, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			if step, err = strconv.Atoi(item[i+1:]); (err != nil) || (step <= 0) {
+				return 0, fmt.Errorf("invalid step in the %s field %q", f.name, item)
+			}
+			item = item[:i]
+		}
+
+		low, high := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			if low, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			high = low
+			if len(bounds) == 2 {
+				if high, err = f.value(bounds[1]); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// a single value with a step runs to the end of the range, such as 5/15
+				high = f.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range in the %s field %q", f.name, item)
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, found := f.names[strings.ToLower(s)]; found {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if (err != nil) || (v < f.min) || (v > f.max) {
+		return 0, fmt.Errorf("the %s field accepts %d through %d, got %q", f.name, f.min, f.max, s)
+	}
+	return v, nil
+}
+
+// Next
+// Returns the first minute after the given time that the expression matches, read in the time
+// zone of the given time. Returns the zero time if nothing matches within MaxCronSearchYears.
+func (expression *Expression) Next(after time.Time) time.Time {
+	location := after.Location()
+
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + MaxCronSearchYears
+
+	for t.Year() <= limit {
+		if !has(expression.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !expression.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		// hours and minutes are stepped over in absolute time, so a clock that falls back
+		// for daylight saving time never sends the search backwards
+		if !has(expression.hour, t.Hour()) {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if !has(expression.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	return time.Time{}
+}
+
+func (expression *Expression) matchesDay(t time.Time) bool {
+	dayOfMonth := has(expression.dayOfMonth, t.Day())
+	dayOfWeek := has(expression.dayOfWeek, int(t.Weekday()))
+
+	if expression.anyDayOfMonth || expression.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
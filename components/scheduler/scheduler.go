@@ -0,0 +1,202 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+func NewScheduler() *Scheduler {
+	scheduler := new(Scheduler)
+	scheduler.entries = make(map[string]*entry)
+	return scheduler
+}
+
+// Add validates the schedule and starts counting down to its first fire
+func (scheduler *Scheduler) Add(schedule Schedule) (success bool, description string) {
+	return scheduler.add(schedule, time.Now())
+}
+
+func (scheduler *Scheduler) add(schedule Schedule, now time.Time) (success bool, description string) {
+	e, description := newEntry(schedule, now)
+	if e == nil {
+		return false, description
+	}
+
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if _, found := scheduler.entries[schedule.Name]; found {
+		return false, "a schedule with that name already exists"
+	}
+
+	e.status.NextFire = e.next(now)
+	scheduler.entries[schedule.Name] = e
+
+	return true, ""
+}
+
+// newEntry returns nil and why if the schedule is not valid
+func newEntry(schedule Schedule, now time.Time) (*entry, string) {
+	if len(schedule.Name) == 0 {
+		return nil, "a schedule needs a name"
+	}
+	if len(schedule.Cluster) == 0 {
+		return nil, "a schedule needs a cluster to provision"
+	}
+
+	e := new(entry)
+
+	switch schedule.Overlap {
+	case "":
+		schedule.Overlap = Skip
+	case Skip, Queue, AllowParallel:
+	default:
+		return nil, fmt.Sprintf("unknown overlap %s", schedule.Overlap)
+	}
+
+	e.location = time.Local
+	if len(schedule.TimeZone) != 0 {
+		location, err := time.LoadLocation(schedule.TimeZone)
+		if err != nil {
+			return nil, fmt.Sprintf("unknown time zone %s", schedule.TimeZone)
+		}
+		e.location = location
+	}
+
+	if (len(schedule.Cron) == 0) == (len(schedule.Every) == 0) {
+		return nil, "a schedule needs either a cron expression or an interval"
+	}
+	if len(schedule.Cron) != 0 {
+		expression, err := ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err.Error()
+		}
+		e.expression = expression
+		// an expression such as the 30th of February is valid, but it would never fire
+		if e.next(now).IsZero() {
+			return nil, fmt.Sprintf("the cron expression %s never matches a time", schedule.Cron)
+		}
+	} else {
+		interval, err := time.ParseDuration(schedule.Every)
+		if (err != nil) || (interval < MinInterval) {
+			return nil, fmt.Sprintf("the interval should be a duration of at least %s", MinInterval)
+		}
+		e.interval = interval
+	}
+
+	e.status.Schedule = schedule
+	return e, ""
+}
+
+// next returns the first fire of the entry after now, an interval keeps to the cadence of the fires before it
+func (e *entry) next(now time.Time) time.Time {
+	if e.expression != nil {
+		return e.expression.Next(now.In(e.location))
+	}
+
+	if e.status.NextFire.IsZero() {
+		return now.Add(e.interval)
+	}
+	// fires missed while the node was busy or down are collapsed into one
+	missed := now.Sub(e.status.NextFire)/e.interval + 1
+	return e.status.NextFire.Add(missed * e.interval)
+}
+
+func (scheduler *Scheduler) Remove(name string) bool {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	if _, found := scheduler.entries[name]; !found {
+		return false
+	}
+	delete(scheduler.entries, name)
+	return true
+}
+
+func (scheduler *Scheduler) Get(name string) (Status, bool) {
+	scheduler.mutex.RLock()
+	defer scheduler.mutex.RUnlock()
+
+	if e, found := scheduler.entries[name]; found {
+		return e.status, true
+	}
+	return Status{}, false
+}
+
+// List returns the status of every schedule ordered by name
+func (scheduler *Scheduler) List() []Status {
+	scheduler.mutex.RLock()
+	defer scheduler.mutex.RUnlock()
+
+	statuses := make([]Status, 0, len(scheduler.entries))
+	for _, e := range scheduler.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses
+}
+
+// Due
+// Returns the schedules to provision at now. A schedule whose last run is still active, as told
+// by isActive, skips or queues the fire unless it allows runs in parallel. A queued fire is handed
+// out once the run before it completes. Every fire handed out must be reported back using Fired.
+func (scheduler *Scheduler) Due(now time.Time, isActive func(cluster string, supervisor uint64) bool) []Fire {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	fires := make([]Fire, 0)
+	for _, e := range scheduler.entries {
+		busy := (e.firing > 0) || ((e.status.LastSupervisor != 0) && isActive(e.status.Cluster, e.status.LastSupervisor))
+
+		if (e.status.NumQueued > 0) && !busy {
+			e.status.NumQueued--
+			fires = append(fires, e.fire(now))
+			busy = true
+		}
+
+		if e.status.NextFire.IsZero() || now.Before(e.status.NextFire) {
+			continue
+		}
+		e.status.NextFire = e.next(now)
+
+		if !busy || (e.status.Overlap == AllowParallel) {
+			fires = append(fires, e.fire(now))
+		} else if (e.status.Overlap == Queue) && (e.status.NumQueued < MaxQueuedFires) {
+			e.status.NumQueued++
+		} else {
+			e.status.NumSkipped++
+		}
+	}
+
+	return fires
+}
+
+func (e *entry) fire(now time.Time) Fire {
+	e.firing++
+	e.status.LastFire = now
+	return Fire{Schedule: e.status.Schedule, At: now}
+}
+
+// Fired records the supervisor a fire provisioned, or why the cluster could not be provisioned
+func (scheduler *Scheduler) Fired(name string, supervisor uint64, success bool, description string) {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+
+	e, found := scheduler.entries[name]
+	if !found {
+		return // the schedule was removed while the cluster was being provisioned
+	}
+
+	if e.firing > 0 {
+		e.firing--
+	}
+	if success {
+		e.status.LastSupervisor = supervisor
+		e.status.LastError = ""
+		e.status.NumFired++
+	} else {
+		e.status.LastError = description
+	}
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("the time zone database is not available")
+	}
+
+	cases := []struct {
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		{"*/15 * * * *", time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC), time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC), time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// both day fields are restricted, so either one matching is enough
+		{"0 0 13 * 5", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC)},
+		// 2:30 does not exist on the day the clocks spring forward
+		{"30 2 * * *", time.Date(2024, 3, 10, 0, 0, 0, 0, newYork), time.Date(2024, 3, 11, 2, 30, 0, 0, newYork)},
+		{"0 8 * * *", time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC).In(newYork), time.Date(2024, 6, 2, 8, 0, 0, 0, newYork)},
+	}
+
+	for _, c := range cases {
+		expression, err := ParseCron(c.spec)
+		if err != nil {
+			t.Fatalf("%s: %s", c.spec, err)
+		}
+		if next := expression.Next(c.after); !next.Equal(c.expected) {
+			t.Errorf("%s after %s: expected %s, got %s", c.spec, c.after, c.expected, next)
+		}
+	}
+
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * * * mon-", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := ParseCron(spec); err == nil {
+			t.Errorf("expected %q to be rejected", spec)
+		}
+	}
+
+	// the expression parses, but a schedule that can never fire is rejected
+	if success, _ := NewScheduler().Add(Schedule{Name: "never", Cluster: "a", Cron: "0 0 30 2 *"}); success {
+		t.Error("expected a schedule for the 30th of February to be rejected")
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	active := true
+	isActive := func(cluster string, supervisor uint64) bool { return active }
+
+	scheduler := NewScheduler()
+	for _, schedule := range []Schedule{
+		{Name: "skip", Cluster: "a", Every: "1m"},
+		{Name: "queue", Cluster: "a", Every: "1m", Overlap: Queue},
+		{Name: "parallel", Cluster: "a", Every: "1m", Overlap: AllowParallel},
+	} {
+		if success, description := scheduler.add(schedule, start); !success {
+			t.Fatal(description)
+		}
+	}
+	if success, _ := scheduler.add(Schedule{Name: "both", Cluster: "a", Cron: "@daily", Every: "1m"}, start); success {
+		t.Error("expected a schedule with a cron expression and an interval to be rejected")
+	}
+
+	// every schedule fires the first time and its run is still active at the next fire
+	fires := scheduler.Due(start.Add(time.Minute), isActive)
+	if len(fires) != 3 {
+		t.Fatalf("expected every schedule to fire, got %d", len(fires))
+	}
+	for _, fire := range fires {
+		scheduler.Fired(fire.Name, 1, true, "")
+	}
+
+	fires = scheduler.Due(start.Add(2*time.Minute+10*time.Second), isActive)
+	if (len(fires) != 1) || (fires[0].Name != "parallel") {
+		t.Fatalf("expected only the parallel schedule to fire, got %v", fires)
+	}
+	scheduler.Fired("parallel", 2, true, "")
+
+	if status, _ := scheduler.Get("skip"); status.NumSkipped != 1 {
+		t.Errorf("expected the fire to be skipped, got %+v", status)
+	}
+	status, _ := scheduler.Get("queue")
+	if status.NumQueued != 1 {
+		t.Errorf("expected the fire to be queued, got %+v", status)
+	}
+	// the interval keeps to the cadence it started with
+	if !status.NextFire.Equal(start.Add(3 * time.Minute)) {
+		t.Errorf("expected the next fire at %s, got %s", start.Add(3*time.Minute), status.NextFire)
+	}
+
+	// the queued fire is handed out as soon as the previous run completes
+	active = false
+	fires = scheduler.Due(start.Add(2*time.Minute+30*time.Second), isActive)
+	if (len(fires) != 1) || (fires[0].Name != "queue") {
+		t.Fatalf("expected the queued fire, got %v", fires)
+	}
+	// a fire that was handed out but not reported back still counts as active
+	fires = scheduler.Due(start.Add(3*time.Minute), isActive)
+	for _, fire := range fires {
+		if fire.Name == "queue" {
+			t.Error("expected the queue schedule to wait for its fire to be reported back")
+		}
+	}
+	if status, _ := scheduler.Get("queue"); status.NumQueued != 1 {
+		t.Errorf("expected the fire to be queued again, got %+v", status)
+	}
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"sync"
+	"time"
+)
+
+const (
+	MaxQueuedFires     = 100 // fires a schedule holds while the previous run is active, any more are skipped
+	MaxCronSearchYears = 5   // an expression that matches nothing within this many years never fires
+	MinInterval        = time.Second
+)
+
+// Overlap is what a schedule does when it fires while the run it last started is still active
+type Overlap string
+
+const (
+	Skip          Overlap = "skip"           // the fire is dropped
+	Queue         Overlap = "queue"          // the fire waits until the previous run completes
+	AllowParallel Overlap = "allow-parallel" // the cluster is provisioned again alongside the previous run
+)
+
+// Schedule provisions a cluster on a cron expression or at a fixed interval
+type Schedule struct {
+	Name       string             `json:"name"`
+	Cluster    string             `json:"cluster"`
+	Config     string             `json:"config,omitempty"` // the config the cluster is provisioned with, the cluster identifier if empty
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+	Cron       string             `json:"cron,omitempty"`      // five fields (minute hour day-of-month month day-of-week) or a descriptor such as @daily
+	Every      string             `json:"every,omitempty"`     // a duration such as 15m, used instead of a cron expression
+	TimeZone   string             `json:"time-zone,omitempty"` // an IANA time zone the cron expression is read in, the local time zone if empty
+	Overlap    Overlap            `json:"overlap,omitempty"`   // skip if empty
+	Priority   int                `json:"priority,omitempty"`  // queued supervisors with a higher priority are admitted first
+}
+
+// Status is a schedule along with when it fires next and what happened the last time it fired
+type Status struct {
+	Schedule
+	NextFire       time.Time `json:"next-fire"`
+	LastFire       time.Time `json:"last-fire"`
+	LastSupervisor uint64    `json:"last-supervisor,omitempty"`
+	LastError      string    `json:"last-error,omitempty"`
+	NumFired       int       `json:"num-fired"`
+	NumSkipped     int       `json:"num-skipped"`
+	NumQueued      int       `json:"num-queued"` // fires waiting for the previous run to complete
+}
+
+// Fire is a schedule that is due to be provisioned
+type Fire struct {
+	Schedule
+	At time.Time
+}
+
+// Expression is a parsed cron expression, every field is a bit set of the values it matches
+type Expression struct {
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	// a day matches either day field when both are restricted, and both otherwise
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+type entry struct {
+	status     Status
+	expression *Expression // nil when the schedule fires at an interval
+	interval   time.Duration
+	location   *time.Location
+	firing     int // fires handed out that have not been reported back
+}
+
+type Scheduler struct {
+	entries map[string]*entry
+	mutex   sync.RWMutex
+}
@@ -0,0 +1,133 @@
+package supervisor
+
+import (
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+)
+
+// activate
+// Counts a new goroutine against the stage, returns false if every goroutine of the
+// stage has already returned and the stage can no longer accept goroutines.
+func (current *attempt) activate(s *stage) bool {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if s.finished {
+		return false
+	}
+
+	s.active++
+	return true
+}
+
+// deactivate
+// Called when a goroutine of the stage returns. When the last goroutine of a stage
+// returns, downstream consumers are told no more data is coming by closing the output
+// channel and any upstream producers are released by cancelling the input channel.
+func (current *attempt) deactivate(s *stage, receiver *channel.Receiver) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	if receiver != nil {
+		if s.partitions != nil {
+			s.partitions.leave(receiver)
+		}
+		current.forget(s, receiver)
+	}
+
+	s.active--
+	if s.active > 0 {
+		return
+	}
+	s.finished = true
+
+	if s.input != nil {
+		s.input.Cancel()
+	}
+	if s.partitions != nil {
+		s.partitions.cancel()
+	}
+	if s.output != nil {
+		s.output.Close()
+	}
+}
+
+// receiver
+// Returns the input of a new goroutine of the stage along with the receiver it is retired by,
+// a partitioned stage gives every goroutine a partition of its own. Extract stages have no input.
+func (current *attempt) receiver(s *stage) (*channel.Receiver, channel.InputChannel) {
+	if s.input == nil {
+		return nil, nil
+	}
+
+	var receiver *channel.Receiver
+	var input channel.InputChannel
+	if s.partitions != nil {
+		receiver, input = s.partitions.join()
+	} else {
+		receiver = s.input.Receiver()
+		input = receiver
+	}
+
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	s.receivers = append(s.receivers, receiver)
+	return receiver, input
+}
+
+// forget removes the receiver of a goroutine that returned, the mutex must be held
+func (current *attempt) forget(s *stage, receiver *channel.Receiver) {
+	for i, r := range s.receivers {
+		if r == receiver {
+			s.receivers = append(s.receivers[:i], s.receivers[i+1:]...)
+			if receiver.IsStopped() {
+				s.retiring--
+			}
+			return
+		}
+	}
+}
+
+// retire
+// Stops the receivers of the n most recently provisioned goroutines of the stage, each
+// goroutine returns the next time it pulls so no data unit it already holds is lost.
+func (current *attempt) retire(s *stage, n int) (retired int) {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	// the goroutines of a partitioned stage are stopped once they finish with their keys
+	if s.partitions != nil {
+		retired = s.partitions.shrink(n)
+		s.retiring += retired
+		return retired
+	}
+
+	for i := len(s.receivers) - 1; (i >= 0) && (retired < n); i-- {
+		if s.receivers[i].IsStopped() {
+			continue
+		}
+		s.receivers[i].Stop()
+		s.retiring++
+		retired++
+	}
+	return retired
+}
+
+// numOfActive returns the number of goroutines of the stage that have not been told to retire
+func (current *attempt) numOfActive(s *stage) int {
+	current.mutex.Lock()
+	defer current.mutex.Unlock()
+
+	return s.active - s.retiring
+}
+
+// first returns the first stage of the segment, or nil if the pipeline has no such stage
+func (current *attempt) first(segment cluster.Segment) *stage {
+	for _, s := range current.stages {
+		if s.Segment == segment {
+			return s
+		}
+	}
+	return nil
+}
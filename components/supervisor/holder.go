@@ -0,0 +1,38 @@
+package supervisor
+
+import "github.com/GabeCordo/etl/components/channel"
+
+func newHolder(input channel.InputChannel) *holder {
+	h := new(holder)
+
+	h.InputChannel = input
+
+	return h
+}
+
+// Pull hands out the next data unit, which the goroutine is holding until it pulls another
+func (h *holder) Pull() (data channel.Message, ok bool) {
+	data, ok = h.InputChannel.Pull()
+
+	h.mutex.Lock()
+	h.held, h.holding = data, ok
+	h.mutex.Unlock()
+
+	return data, ok
+}
+
+// Sequenced returns true if the input the holder wraps is Sequenced
+func (h *holder) Sequenced() bool {
+	sequenced, ok := h.InputChannel.(channel.Sequenced)
+	return ok && sequenced.Sequenced()
+}
+
+// release returns the data unit the goroutine was holding, false if it was not holding one
+func (h *holder) release() (data channel.Message, holding bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	data, holding = h.held, h.holding
+	h.held, h.holding = nil, false
+	return data, holding
+}
@@ -0,0 +1,337 @@
+package supervisor
+
+import (
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+	"hash/fnv"
+	"sync"
+)
+
+func newPartitioner(name string, input *channel.ManagedChannel, key cluster.KeyFunc) *partitioner {
+	p := new(partitioner)
+
+	p.name = name
+	p.key = key
+	p.input = input
+	p.table = make([]*partition, 0)
+	p.joining = make([]*partition, 0)
+	p.changed = make(chan struct{})
+	p.cancelled = make(chan struct{})
+	p.idle = sync.NewCond(&p.mutex)
+
+	return p
+}
+
+// newPartition creates the channel of a goroutine, it only buffers a few data units so a
+// backlog stays visible to the scaling policy on the input of the stage
+func (p *partitioner) newPartition() *partition {
+	c := channel.NewManagedChannel(p.input.Config.Threshold, p.input.Config.GrowthFactor, p.input.Config.Threshold)
+	c.Config.Name = p.name
+
+	return &partition{channel: c, receiver: c.Receiver()}
+}
+
+// run
+// Routes the input to the partitions until the input is done, the partitions are closed
+// afterwards so every goroutine returns once it has pulled the data units routed to it.
+func (p *partitioner) run() {
+	defer p.close()
+
+	pending := make([]channel.Message, 0) // data units waiting to be routed, oldest first
+	for !p.isCancelled() {
+		changed := p.changes()
+
+		if len(pending) == 0 {
+			data, ok := p.input.PullUntil(changed)
+			if ok {
+				pending = append(pending, data)
+			} else if !isClosed(changed) {
+				return // the input is done or was cancelled
+			}
+		}
+
+		if isClosed(changed) {
+			backlog, ok := p.rebalance()
+			if !ok {
+				return
+			}
+			// data units left behind by a goroutine that returned were routed before anything pending
+			pending = append(backlog, pending...)
+			continue
+		}
+
+		target := p.route(pending[0])
+		if target == nil {
+			// every goroutine has returned, wait for one to be provisioned
+			select {
+			case <-changed:
+			case <-p.cancelled:
+			}
+			continue
+		}
+
+		if target.channel.PushUntil(pending[0], changed) {
+			pending = pending[1:]
+		} else {
+			p.unroute(target)
+		}
+	}
+}
+
+// route picks the partition of the data unit and counts it against the partition, nil if the table is empty
+func (p *partitioner) route(data channel.Message) *partition {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if len(p.table) == 0 {
+		return nil
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(p.key(data)))
+	target := p.table[hash.Sum32()%uint32(len(p.table))]
+	target.pushed++
+
+	return target
+}
+
+// unroute takes back a data unit that was routed to the partition but never pushed
+func (p *partitioner) unroute(target *partition) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	target.pushed--
+}
+
+// rebalance
+// Waits until every goroutine in the table has finished with the data units routed to it,
+// then applies the goroutines that joined or left. The data units left behind by goroutines
+// that returned are handed back so they can be routed before anything newer.
+func (p *partitioner) rebalance() (backlog []channel.Message, ok bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.changed = make(chan struct{})
+
+	for !p.isSettled() {
+		if p.isCancelled() {
+			return nil, false
+		}
+		p.idle.Wait()
+	}
+
+	table := make([]*partition, 0, len(p.table)+len(p.joining))
+	backlog = make([]channel.Message, 0)
+	for _, existing := range p.table {
+		if existing.orphaned {
+			backlog = append(backlog, existing.drain()...)
+		} else if existing.leaving {
+			existing.receiver.Stop()
+		} else {
+			table = append(table, existing)
+		}
+	}
+	for _, joined := range p.joining {
+		if !joined.orphaned {
+			table = append(table, joined)
+		}
+	}
+
+	p.table = table
+	p.joining = make([]*partition, 0)
+	p.rebalances++
+
+	return backlog, true
+}
+
+// isSettled returns true once no goroutine in the table holds a data unit, the mutex must be held
+func (p *partitioner) isSettled() bool {
+	for _, existing := range p.table {
+		if !existing.orphaned && (existing.finished != existing.pushed) {
+			return false
+		}
+	}
+	return true
+}
+
+// drain pulls the data units that are still waiting in the partition, nobody else pulls from an orphan
+func (existing *partition) drain() []channel.Message {
+	backlog := make([]channel.Message, 0)
+	for n := existing.channel.Metrics().Depth; n > 0; n-- {
+		data, ok := existing.channel.Pull()
+		if !ok {
+			break
+		}
+		backlog = append(backlog, data)
+	}
+	return backlog
+}
+
+// join
+// Gives a new goroutine of the stage a partition to pull from. A goroutine replacing one that
+// returned takes over its partition, and with it the keys and any data units left waiting.
+func (p *partitioner) join() (*channel.Receiver, channel.InputChannel) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var target *partition
+	for _, existing := range p.partitions() {
+		if existing.orphaned {
+			target = existing
+			target.orphaned = false
+			target.finished = target.taken // whatever the last goroutine held is lost with it
+			target.receiver = target.channel.Receiver()
+			break
+		}
+	}
+
+	if target == nil {
+		target = p.newPartition()
+		if p.closed {
+			// nothing more will be routed, the goroutine returns as soon as it pulls
+			target.channel.Close()
+		} else if p.isCancelled() {
+			target.channel.Cancel()
+		} else {
+			p.joining = append(p.joining, target)
+			p.signal()
+		}
+	}
+
+	return target.receiver, member{partitioner: p, partition: target, receiver: target.receiver}
+}
+
+// leave
+// Called when a goroutine of the stage returns, the partition is left for the next goroutine
+// provisioned to take over, or removed at the next rebalance if none is.
+func (p *partitioner) leave(receiver *channel.Receiver) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, existing := range p.partitions() {
+		if existing.receiver != receiver {
+			continue
+		}
+
+		// a goroutine that returns before its retirement took effect is still counted as retired
+		if existing.leaving {
+			existing.receiver.Stop()
+		}
+		existing.orphaned = true
+		p.signal()
+		p.idle.Broadcast()
+		return
+	}
+}
+
+// shrink
+// Marks the n most recently joined goroutines in the table to be retired at the next rebalance,
+// returns the number marked. Nothing is retired once the input is done.
+func (p *partitioner) shrink(n int) (retired int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return 0
+	}
+
+	for i := len(p.table) - 1; (i >= 0) && (retired < n); i-- {
+		if p.table[i].leaving || p.table[i].orphaned {
+			continue
+		}
+		p.table[i].leaving = true
+		retired++
+	}
+
+	if retired > 0 {
+		p.signal()
+	}
+	return retired
+}
+
+// close tells every goroutine that nothing more will be routed to it
+func (p *partitioner) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.closed = true
+	for _, existing := range p.partitions() {
+		existing.channel.Close()
+	}
+}
+
+// cancel releases the partitioner and the goroutines when the stage finishes early or the attempt is torn down
+func (p *partitioner) cancel() {
+	p.cancelOnce.Do(func() {
+		close(p.cancelled)
+
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+
+		for _, existing := range p.partitions() {
+			existing.channel.Cancel()
+		}
+		p.idle.Broadcast()
+	})
+}
+
+func (p *partitioner) isCancelled() bool {
+	return isClosed(p.cancelled)
+}
+
+// signal asks the partitioner to rebalance, the mutex must be held
+func (p *partitioner) signal() {
+	if !isClosed(p.changed) {
+		close(p.changed)
+	}
+}
+
+// changes returns the channel closed by the next change to the goroutines of the stage
+func (p *partitioner) changes() chan struct{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.changed
+}
+
+// partitions returns the partitions in the table followed by those joining, the mutex must be held
+func (p *partitioner) partitions() []*partition {
+	partitions := make([]*partition, 0, len(p.table)+len(p.joining))
+	partitions = append(partitions, p.table...)
+	return append(partitions, p.joining...)
+}
+
+// size returns the number of partitions in the table and the number of times it was rebalanced
+func (p *partitioner) size() (partitions, rebalances int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.table), p.rebalances
+}
+
+// Pull marks the data unit pulled before as finished, the partitioner waits on this before rebalancing
+func (m member) Pull() (data channel.Message, ok bool) {
+	m.partitioner.mutex.Lock()
+	if m.partition.receiver == m.receiver {
+		m.partition.finished = m.partition.taken
+		m.partitioner.idle.Broadcast()
+	}
+	m.partitioner.mutex.Unlock()
+
+	data, ok = m.receiver.Pull()
+	if ok {
+		m.partitioner.mutex.Lock()
+		m.partition.taken++
+		m.partitioner.mutex.Unlock()
+	}
+	return data, ok
+}
+
+func isClosed(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
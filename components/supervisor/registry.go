@@ -2,6 +2,7 @@ package supervisor
 
 import (
 	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/deadletter"
 	"math"
 )
 
@@ -9,6 +10,7 @@ func NewRegistry(clusterName string, clusterImplementation cluster.Cluster) *Reg
 	registry := new(Registry)
 
 	registry.supervisors = make(map[uint64]*Supervisor)
+	registry.deadLetters = deadletter.NewStore()
 	registry.idReference = 0
 
 	registry.identifier = clusterName
@@ -59,6 +61,8 @@ func (registry *Registry) CreateSupervisor(config ...cluster.Config) *Supervisor
 		supervisor = NewSupervisor(registry.identifier, registry.implementation)
 	}
 	supervisor.Id = id
+	supervisor.cluster = registry.identifier
+	supervisor.deadLetters = registry.deadLetters
 
 	registry.supervisors[id] = supervisor
 	return supervisor
@@ -88,6 +92,65 @@ func (registry *Registry) GetSupervisors() []*Supervisor {
 	return supervisors
 }
 
+// Acquire counts another running supervisor against the cluster, false if it already runs max supervisors, zero is no limit
+func (registry *Registry) Acquire(max int) bool {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if (max > 0) && (registry.numOfActiveSupervisors >= uint64(max)) {
+		return false
+	}
+	registry.numOfActiveSupervisors++
+	return true
+}
+
+// Release stops counting a supervisor that completed against the cluster
+func (registry *Registry) Release() {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.numOfActiveSupervisors > 0 {
+		registry.numOfActiveSupervisors--
+	}
+}
+
+func (registry *Registry) NumOfActiveSupervisors() uint64 {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+
+	return registry.numOfActiveSupervisors
+}
+
+// DeadLetters returns the store of data units rejected by every supervisor of the cluster
+func (registry *Registry) DeadLetters() *deadletter.Store {
+	return registry.deadLetters
+}
+
+// Resubmit
+// Pushes a dead-lettered data unit back to the stage that rejected it. The supervisor that
+// rejected it is used if it is still running, otherwise any running supervisor of the cluster.
+func (registry *Registry) Resubmit(id uint64) (success bool, description string) {
+	record, found := registry.deadLetters.Get(id)
+	if !found {
+		return false, "record not found"
+	}
+
+	candidates := make([]*Supervisor, 0)
+	if supervisor, found := registry.GetSupervisor(record.Supervisor); found {
+		candidates = append(candidates, supervisor)
+	}
+	candidates = append(candidates, registry.GetSupervisors()...)
+
+	for _, supervisor := range candidates {
+		if supervisor.IsActive() && supervisor.Resubmit(record.Stage, record.Data) {
+			registry.deadLetters.Remove(id)
+			return true, ""
+		}
+	}
+
+	return false, "no running supervisor can accept the record"
+}
+
 func (registry *Registry) GetClusterImplementation() cluster.Cluster {
 
 	return registry.implementation
@@ -2,6 +2,7 @@ package supervisor
 
 import (
 	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/deadletter"
 	"sync"
 )
 
@@ -13,7 +14,9 @@ type Registry struct {
 	mounted        bool
 
 	supervisors            map[uint64]*Supervisor
-	numOfActiveSupervisors uint64
+	numOfActiveSupervisors uint64 // supervisors admitted to run that have not yet completed
+
+	deadLetters *deadletter.Store
 
 	idReference uint64
 	mutex       sync.RWMutex
@@ -0,0 +1,186 @@
+package supervisor
+
+import (
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+	"math"
+	"time"
+)
+
+const (
+	DefaultScalingStep = 1
+
+	// gains of the target-depth policy, the error is measured relative to the target depth
+	TargetDepthProportionalGain = 0.5
+	TargetDepthIntegralGain     = 0.1
+	TargetDepthDerivativeGain   = 0.05
+	TargetDepthMaxIntegral      = 5
+)
+
+var policies = &scalingRegistry{
+	factories: map[string]ScalingPolicyFactory{
+		ThresholdPolicy: func(config cluster.Config) ScalingPolicy {
+			return new(thresholdScaling)
+		},
+		LinearPolicy: func(config cluster.Config) ScalingPolicy {
+			policy := new(linearScaling)
+			policy.step = config.ScalingStep
+			if policy.step <= 0 {
+				policy.step = DefaultScalingStep
+			}
+			return policy
+		},
+		TargetDepthPolicy: func(config cluster.Config) ScalingPolicy {
+			policy := new(targetDepthScaling)
+			policy.target = float64(config.TargetDepth)
+			return policy
+		},
+		ThroughputPolicy: func(config cluster.Config) ScalingPolicy {
+			policy := new(throughputScaling)
+			policy.perRoutine = config.TargetThroughput
+			return policy
+		},
+	},
+}
+
+// RegisterScalingPolicy
+// Makes a custom policy available to clusters that name it in the scaling-policy of their
+// config, returns false if a policy is already registered under the name.
+func RegisterScalingPolicy(name string, factory ScalingPolicyFactory) bool {
+	policies.mutex.Lock()
+	defer policies.mutex.Unlock()
+
+	if _, found := policies.factories[name]; found || (factory == nil) {
+		return false
+	}
+
+	policies.factories[name] = factory
+	return true
+}
+
+// IsScalingPolicy returns true if a policy is registered under the name, no name is the threshold policy
+func IsScalingPolicy(name string) bool {
+	if name == "" {
+		return true
+	}
+
+	policies.mutex.RLock()
+	defer policies.mutex.RUnlock()
+
+	_, found := policies.factories[name]
+	return found
+}
+
+// NewScalingPolicy
+// Creates the policy named by the config, the threshold policy is used when no policy is
+// named and found is false if the name has not been registered.
+func NewScalingPolicy(config cluster.Config) (policy ScalingPolicy, found bool) {
+	name := config.ScalingPolicy
+	if name == "" {
+		name = ThresholdPolicy
+	}
+
+	policies.mutex.RLock()
+	factory, found := policies.factories[name]
+	if !found {
+		factory = policies.factories[ThresholdPolicy]
+	}
+	policies.mutex.RUnlock()
+
+	return factory(config), found
+}
+
+// Desired multiplies the goroutines by the growth factor when the channel is congested and
+// divides them by the growth factor once it has been empty for the cooldown
+func (policy *thresholdScaling) Desired(input ScalingInput) (int, string) {
+	growthFactor := input.GrowthFactor
+	if growthFactor < 1 {
+		growthFactor = 1 // a growth factor of one leaves the stage at a fixed size
+	}
+
+	if input.Channel.State == channel.Congested {
+		return input.Active * growthFactor, "congested"
+	} else if (input.IdleFor > 0) && (input.IdleFor >= input.Cooldown) {
+		return input.Active / growthFactor, "idle"
+	}
+	return input.Active, ""
+}
+
+// Desired adds a fixed number of goroutines when the channel is congested and removes the
+// same number once it has been empty for the cooldown
+func (policy *linearScaling) Desired(input ScalingInput) (int, string) {
+	if input.Channel.State == channel.Congested {
+		return input.Active + policy.step, "congested"
+	} else if (input.IdleFor > 0) && (input.IdleFor >= input.Cooldown) {
+		return input.Active - policy.step, "idle"
+	}
+	return input.Active, ""
+}
+
+// Desired
+// Treats the number of goroutines as the output of a PID controller that tries to keep the
+// depth of the channel at the target. Without a target depth half the threshold is used.
+func (policy *targetDepthScaling) Desired(input ScalingInput) (int, string) {
+	target := policy.target
+	if target <= 0 {
+		target = math.Max(float64(input.Threshold)/2, 1)
+	}
+
+	seconds := input.Interval.Seconds()
+	if seconds <= 0 {
+		return input.Active, ""
+	}
+
+	err := (float64(input.Channel.Depth) - target) / target
+
+	policy.integral = math.Max(-TargetDepthMaxIntegral, math.Min(TargetDepthMaxIntegral, policy.integral+err*seconds))
+	derivative := 0.0
+	if policy.hasSampled {
+		derivative = (err - policy.previous) / seconds
+	}
+	policy.previous, policy.hasSampled = err, true
+
+	output := (TargetDepthProportionalGain * err) + (TargetDepthIntegralGain * policy.integral) + (TargetDepthDerivativeGain * derivative)
+	return int(math.Round(float64(input.Active) * (1 + output))), "target-depth"
+}
+
+// Desired
+// Provisions enough goroutines for the rate data units are pushed into the channel. The rate
+// a single goroutine can handle is taken from the config, or measured while data is waiting.
+func (policy *throughputScaling) Desired(input ScalingInput) (int, string) {
+	enqueued, dequeued := input.Channel.Enqueued, input.Channel.Dequeued
+	defer func() {
+		policy.enqueued, policy.dequeued, policy.sampled = enqueued, dequeued, true
+	}()
+
+	seconds := input.Interval.Seconds()
+	if !policy.sampled || (seconds <= 0) || (input.Active == 0) {
+		return input.Active, ""
+	}
+
+	inRate := float64(enqueued-policy.enqueued) / seconds
+	outRate := float64(dequeued-policy.dequeued) / seconds
+
+	perRoutine := policy.perRoutine
+	if (perRoutine <= 0) && (input.Channel.Depth > 0) {
+		// the goroutines are saturated while data is waiting, so this is the most they can handle
+		perRoutine = outRate / float64(input.Active)
+	}
+
+	if perRoutine > 0 {
+		return int(math.Ceil(inRate / perRoutine)), "throughput"
+	} else if (input.IdleFor > 0) && (input.IdleFor >= input.Cooldown) {
+		return input.Active - 1, "idle"
+	}
+	return input.Active, ""
+}
+
+func newScaler(stage *stage, policy ScalingPolicy) *scaler {
+	s := new(scaler)
+
+	s.stage = stage
+	s.policy = policy
+	s.lastTick = time.Now()
+
+	return s
+}
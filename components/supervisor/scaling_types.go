@@ -0,0 +1,76 @@
+package supervisor
+
+import (
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+	"sync"
+	"time"
+)
+
+const (
+	ThresholdPolicy   = "threshold"
+	LinearPolicy      = "linear"
+	TargetDepthPolicy = "target-depth"
+	ThroughputPolicy  = "throughput"
+)
+
+// ScalingInput is what the supervisor observed about a stage since the last tick of the monitor
+type ScalingInput struct {
+	Stage        string
+	Segment      cluster.Segment
+	Active       int             // goroutines of the stage that have not been told to retire
+	Minimum      int             // the stage limits, the supervisor clamps whatever the policy returns
+	Maximum      int             //
+	Channel      channel.Metrics // the channel the stage pulls from
+	Threshold    int
+	GrowthFactor int
+	Interval     time.Duration // time since the previous tick
+	IdleFor      time.Duration // how long the channel has been empty, zero if it is not empty
+	Cooldown     time.Duration
+}
+
+// ScalingPolicy
+// Decides how many goroutines a segment should have. A policy is created for each stage of
+// every attempt, so it can keep state between ticks without being shared across stages.
+type ScalingPolicy interface {
+	Desired(input ScalingInput) (desired int, reason string)
+}
+
+// ScalingPolicyFactory creates a policy for a stage from the config of the cluster
+type ScalingPolicyFactory func(config cluster.Config) ScalingPolicy
+
+type scalingRegistry struct {
+	factories map[string]ScalingPolicyFactory
+	mutex     sync.RWMutex
+}
+
+// scaler is the per stage state the monitor keeps for a policy
+type scaler struct {
+	stage  *stage
+	policy ScalingPolicy
+
+	idleSince  time.Time
+	lastScaled time.Time
+	lastTick   time.Time
+}
+
+type thresholdScaling struct{}
+
+type linearScaling struct {
+	step int
+}
+
+type targetDepthScaling struct {
+	target     float64
+	integral   float64
+	previous   float64
+	hasSampled bool
+}
+
+type throughputScaling struct {
+	perRoutine float64 // data units a second a single goroutine is expected to handle, 0 to measure it
+
+	enqueued uint64
+	dequeued uint64
+	sampled  bool
+}
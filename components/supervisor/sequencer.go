@@ -0,0 +1,203 @@
+package supervisor
+
+import (
+	"context"
+	"github.com/GabeCordo/etl/components/channel"
+	"sort"
+)
+
+func newSequencer(input, output *channel.ManagedChannel, size int) *sequencer {
+	seq := new(sequencer)
+
+	seq.input = input
+	seq.output = output
+	seq.size = size
+	seq.pending = make(map[uint64][]channel.Message)
+	seq.credits = make(chan struct{}, size)
+	seq.done = make(chan struct{})
+
+	return seq
+}
+
+// number
+// Hands out the next sequence number, blocking while the reorder buffer could not hold another
+// data unit. Returns false if the attempt ends or the tail stops accepting data units first.
+func (seq *sequencer) number(ctx context.Context) (n uint64, ok bool) {
+	select {
+	case seq.credits <- struct{}{}:
+	case <-ctx.Done():
+		return 0, false
+	case <-seq.done:
+		return 0, false
+	}
+
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+
+	n = seq.next
+	seq.next++
+	return n, true
+}
+
+// run
+// Releases the groups pushed by the last transform stage to the tail in sequence order and
+// closes the tail once the input is done. Returns early, cancelling the input, if every load
+// stage has returned and the tail was cancelled.
+func (seq *sequencer) run() {
+	defer close(seq.done)
+	defer seq.output.Close()
+
+	for data, ok := seq.input.Pull(); ok; data, ok = seq.input.Pull() {
+		if group, isSequenced := data.(*sequenced); isSequenced {
+			for _, item := range seq.release(group) {
+				seq.output.Push(item)
+			}
+		} else {
+			// resubmitted data units were never numbered, there is nothing to order them by
+			seq.output.Push(data)
+		}
+
+		if seq.output.IsCancelled() {
+			seq.input.Cancel()
+			return
+		}
+	}
+
+	// the input is done, groups still waiting on a sequence number that never arrived are released in order
+	for _, item := range seq.flush() {
+		seq.output.Push(item)
+	}
+}
+
+// release adds the group to the buffer and returns the data units that are now in order
+func (seq *sequencer) release(group *sequenced) []channel.Message {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+
+	seq.pending[group.seq] = group.items
+
+	ready := make([]channel.Message, 0)
+	for items, found := seq.pending[seq.released]; found; items, found = seq.pending[seq.released] {
+		ready = append(ready, items...)
+		delete(seq.pending, seq.released)
+		seq.released++
+		<-seq.credits
+	}
+
+	if len(seq.pending) > seq.highWaterMark {
+		seq.highWaterMark = len(seq.pending)
+	}
+	return ready
+}
+
+// flush empties the buffer, returning the data units of every group it held in sequence order
+func (seq *sequencer) flush() []channel.Message {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+
+	numbers := make([]uint64, 0, len(seq.pending))
+	for n := range seq.pending {
+		numbers = append(numbers, n)
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	ready := make([]channel.Message, 0)
+	for _, n := range numbers {
+		ready = append(ready, seq.pending[n]...)
+		delete(seq.pending, n)
+	}
+	return ready
+}
+
+// occupancy returns the size of the reorder buffer, the groups it holds and the most it has held
+func (seq *sequencer) occupancy() (size, occupancy, highWaterMark int) {
+	seq.mutex.Lock()
+	defer seq.mutex.Unlock()
+
+	return seq.size, len(seq.pending), seq.highWaterMark
+}
+
+func newOrdered(ctx context.Context, seq *sequencer, input channel.InputChannel, output channel.OutputChannel) *ordered {
+	o := new(ordered)
+
+	o.ctx = ctx
+	o.sequencer = seq
+	o.input = input
+	o.output = output
+
+	return o
+}
+
+// Push numbers the data units of an extract stage, the data units of a transform stage join the group it last pulled
+func (o *ordered) Push(data channel.Message) {
+	if o.input == nil {
+		if n, ok := o.sequencer.number(o.ctx); ok {
+			o.output.Push(&sequenced{seq: n, items: []channel.Message{data}})
+		}
+		return
+	}
+
+	o.mutex.Lock()
+	if o.current != nil {
+		o.outputs = append(o.outputs, data)
+		o.mutex.Unlock()
+		return
+	}
+	o.mutex.Unlock()
+
+	o.output.Push(data)
+}
+
+// Sequenced returns true if the goroutine pulls from a stage, the data units it pushes are then grouped by what it pulled
+func (o *ordered) Sequenced() bool {
+	return o.input != nil
+}
+
+// Pull hands out the data units of a group one at a time, the next group is pulled once the goroutine is done with them
+func (o *ordered) Pull() (data channel.Message, ok bool) {
+	o.mutex.Lock()
+	if (o.current != nil) && (o.index < len(o.current.items)) {
+		data = o.current.items[o.index]
+		o.index++
+		o.mutex.Unlock()
+		return data, true
+	}
+	o.mutex.Unlock()
+
+	o.flush()
+
+	for {
+		data, ok = o.input.Pull()
+		if !ok {
+			return nil, false
+		}
+
+		group, isSequenced := data.(*sequenced)
+		if !isSequenced {
+			return data, true
+		}
+		// a data unit filtered out by an earlier stage still has to be released
+		if len(group.items) == 0 {
+			o.output.Push(group)
+			continue
+		}
+
+		o.mutex.Lock()
+		o.current, o.index, o.outputs = group, 1, make([]channel.Message, 0)
+		o.mutex.Unlock()
+
+		return group.items[0], true
+	}
+}
+
+// flush passes on what the goroutine pushed for the group it last pulled, an empty group if it pushed nothing
+func (o *ordered) flush() {
+	o.mutex.Lock()
+	group, outputs := o.current, o.outputs
+	o.current, o.outputs = nil, nil
+	o.mutex.Unlock()
+
+	if group != nil {
+		o.output.Push(&sequenced{seq: group.seq, items: outputs})
+	}
+}
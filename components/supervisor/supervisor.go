@@ -1,9 +1,14 @@
 package supervisor
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/GabeCordo/etl/components/channel"
 	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/deadletter"
+	"math"
+	"runtime/debug"
 	"time"
 )
 
@@ -12,25 +17,35 @@ const (
 	DefaultMonitorRefreshDuration = 1
 	DefaultChannelThreshold       = 10
 	DefaultChannelGrowthFactor    = 2
+	DefaultCancelGracePeriod      = 5 // seconds
+	DefaultMaxRestarts            = 3
+	DefaultRestartBackoff         = 1  // seconds
+	DefaultMaxRestartBackoff      = 60 // seconds
+	DefaultMaxWorkerReplacements  = 10
+	DefaultMinRoutines            = 1
+	DefaultMaxRoutines            = 32
+	DefaultScaleDownCooldown      = 30 // seconds
+	DefaultReorderBufferSize      = 1000
+	MaxScaleEvents                = 100
 )
 
 func NewSupervisor(clusterName string, clusterImplementation cluster.Cluster) *Supervisor {
 	supervisor := new(Supervisor)
 
 	supervisor.group = clusterImplementation
+	supervisor.cluster = clusterName
 	supervisor.Config = cluster.Config{
-		clusterName,
-		DefaultChannelThreshold,
-		DefaultNumberOfClusters,
-		DefaultNumberOfClusters,
-		DefaultChannelGrowthFactor,
-		DefaultChannelThreshold,
-		DefaultChannelGrowthFactor,
-		DefaultChannelGrowthFactor,
+		Identifier:                  clusterName,
+		StartWithNTransformClusters: DefaultNumberOfClusters,
+		StartWithNLoadClusters:      DefaultNumberOfClusters,
+		ETChannelThreshold:          DefaultChannelThreshold,
+		ETChannelGrowthFactor:       DefaultChannelGrowthFactor,
+		TLChannelThreshold:          DefaultChannelThreshold,
+		TLChannelGrowthFactor:       DefaultChannelGrowthFactor,
 	}
+	supervisor.ctx, supervisor.cancel = context.WithCancel(context.Background())
 	supervisor.Stats = cluster.NewStatistics()
-	supervisor.etChannel = channel.NewManagedChannel(supervisor.Config.ETChannelThreshold, supervisor.Config.ETChannelGrowthFactor)
-	supervisor.tlChannel = channel.NewManagedChannel(supervisor.Config.TLChannelThreshold, supervisor.Config.TLChannelGrowthFactor)
+	supervisor.Panics = make([]WorkerPanic, 0)
 
 	return supervisor
 }
@@ -46,10 +61,12 @@ func NewCustomSupervisor(clusterImplementation cluster.Cluster, config cluster.C
 	 */
 
 	supervisor.group = clusterImplementation
+	// a supervisor created by a registry is given the name the cluster was registered under instead
+	supervisor.cluster = config.Identifier
 	supervisor.Config = config
+	supervisor.ctx, supervisor.cancel = context.WithCancel(context.Background())
 	supervisor.Stats = cluster.NewStatistics()
-	supervisor.etChannel = channel.NewManagedChannel(config.ETChannelThreshold, config.ETChannelGrowthFactor)
-	supervisor.tlChannel = channel.NewManagedChannel(config.TLChannelThreshold, config.TLChannelGrowthFactor)
+	supervisor.Panics = make([]WorkerPanic, 0)
 
 	return supervisor
 }
@@ -61,6 +78,22 @@ func (supervisor *Supervisor) Event(event Event) bool {
 	if supervisor.State == UnTouched {
 		if event == Startup {
 			supervisor.State = Running
+		} else if event == Queue {
+			supervisor.State = Queued
+		} else if event == Error {
+			supervisor.State = Failed
+		} else if event == Cancel {
+			supervisor.State = Cancelled
+		} else {
+			return false
+		}
+	} else if supervisor.State == Queued {
+		if event == Startup {
+			supervisor.State = Running
+		} else if event == Error {
+			supervisor.State = Failed
+		} else if event == Cancel {
+			supervisor.State = Cancelled
 		} else {
 			return false
 		}
@@ -71,6 +104,20 @@ func (supervisor *Supervisor) Event(event Event) bool {
 			supervisor.State = Failed
 		} else if event == TearedDown {
 			supervisor.State = Terminated
+		} else if event == Cancel {
+			supervisor.State = Cancelled
+		} else if event == Crashed {
+			supervisor.State = Restarting
+		} else {
+			return false
+		}
+	} else if supervisor.State == Restarting {
+		if event == Startup {
+			supervisor.State = Running
+		} else if event == Error {
+			supervisor.State = Failed
+		} else if event == Cancel {
+			supervisor.State = Cancelled
 		} else {
 			return false
 		}
@@ -79,10 +126,12 @@ func (supervisor *Supervisor) Event(event Event) bool {
 			supervisor.State = Running
 		} else if event == Error {
 			supervisor.State = Failed
+		} else if event == Cancel {
+			supervisor.State = Cancelled
 		} else {
 			return false
 		}
-	} else if (supervisor.State == Failed) || (supervisor.State == Terminated) {
+	} else if (supervisor.State == Failed) || (supervisor.State == Terminated) || (supervisor.State == Cancelled) {
 		return false
 	}
 
@@ -90,103 +139,1156 @@ func (supervisor *Supervisor) Event(event Event) bool {
 }
 
 func (supervisor *Supervisor) Start() (response *cluster.Response) {
+	// a supervisor stopped before it started, such as while it was queued, never runs
+	if supervisor.lifetime().Err() != nil {
+		supervisor.Event(Cancel)
+		response = cluster.NewResponse(supervisor.Config, supervisor.Statistics(), 0, false)
+		response.Cancelled = true
+		response.Parameters = supervisor.Parameters
+		return response
+	}
+
 	supervisor.Event(Startup)
 	defer supervisor.Event(TearedDown)
+	// any stage still observing the context is told to stop once the supervisor tears down
+	defer supervisor.cancel()
+
+	supervisor.StartTime = time.Now()
+
+	// the deadline is relative to when the supervisor starts, not when it was created
+	if supervisor.Config.MaxRuntime > 0 {
+		supervisor.mutex.Lock()
+		var cancelDeadline context.CancelFunc
+		maxRuntime := time.Duration(supervisor.Config.MaxRuntime * float64(time.Minute))
+		supervisor.ctx, cancelDeadline = context.WithTimeout(supervisor.ctx, maxRuntime)
+		supervisor.mutex.Unlock()
+		defer cancelDeadline()
+	}
+
+	// a pipeline without an extract or load stage has nothing to run, nor does a config naming a policy that does not exist
+	if !supervisor.pipeline().IsValid() || !IsScalingPolicy(supervisor.Config.ScalingPolicy) {
+		supervisor.Event(Error)
+		return cluster.NewResponse(supervisor.Config, supervisor.Statistics(), time.Now().Sub(supervisor.StartTime), true)
+	}
+
+	// whatever the stages share is set up once for the run, not once for every attempt
+	hooks := cluster.HooksOf(supervisor.group)
+	if hooks.Setup != nil {
+		err := supervisor.callHook("setup", func() error {
+			return hooks.Setup(supervisor.hookContext(supervisor.lifetime()))
+		})
+		if err != nil {
+			supervisor.Event(Error)
+			response = cluster.NewResponse(supervisor.Config, supervisor.Statistics(), time.Now().Sub(supervisor.StartTime), false)
+			response.Parameters = supervisor.Parameters
+			response.Outputs = supervisor.outputs()
+			response.SetupError = err.Error()
+			supervisor.onFailure(hooks, response)
+			return response
+		}
+	}
+
+	restarts := make([]time.Time, 0)
+	for {
+		response = supervisor.run()
+		if !response.DidItCrash || response.Cancelled {
+			break
+		}
+
+		backoff, restart := supervisor.nextRestart(restarts)
+		if !restart {
+			// the cluster is not allowed to restart, or it has crashed too many times
+			supervisor.Event(Error)
+			break
+		}
+
+		restarts = append(restarts, time.Now())
+		supervisor.mutex.Lock()
+		supervisor.Stats.NumRestarts++
+		supervisor.Stats.Restarts = append(supervisor.Stats.Restarts, cluster.RestartAttempt{
+			Attempt:   supervisor.Attempt,
+			CrashedAt: time.Now(),
+			Backoff:   backoff,
+		})
+		supervisor.mutex.Unlock()
+		supervisor.Event(Crashed)
+
+		select {
+		case <-time.After(backoff):
+			supervisor.Event(Startup)
+			continue
+		case <-supervisor.lifetime().Done():
+			// the supervisor was stopped while waiting to restart
+			supervisor.Event(Cancel)
+			response.Cancelled = true
+		}
+		break
+	}
+
+	// the context of the supervisor may already be cancelled, the teardown is given one of its own
+	if hooks.Teardown != nil {
+		err := supervisor.callHook("teardown", func() error {
+			return hooks.Teardown(supervisor.hookContext(context.Background()))
+		})
+		if err != nil {
+			response.TeardownError = err.Error()
+		}
+	}
+
+	response.LapsedTime = time.Now().Sub(supervisor.StartTime)
+	response.Stats = supervisor.Statistics()
+	response.Parameters = supervisor.Parameters
+	response.Outputs = supervisor.outputs()
+	response.DeadlineExceeded = response.Cancelled && supervisor.DeadlineExceeded()
+
+	if response.DidItCrash {
+		supervisor.onFailure(hooks, response)
+	}
+
+	return response
+}
+
+// onFailure calls the failure hook of the run, if it has one
+func (supervisor *Supervisor) onFailure(hooks cluster.Hooks, response *cluster.Response) {
+	if hooks.OnFailure == nil {
+		return
+	}
+
+	supervisor.callHook("on-failure", func() error {
+		hooks.OnFailure(supervisor.hookContext(context.Background()), response)
+		return nil
+	})
+}
+
+// callHook
+// Calls a lifecycle hook of the run. A hook that panics is recorded with the panics of the
+// workers and returned as an error, so it fails the run rather than the node.
+func (supervisor *Supervisor) callHook(name string, hook func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			supervisor.mutex.Lock()
+			supervisor.Panics = append(supervisor.Panics, WorkerPanic{
+				Attempt:   supervisor.Attempt,
+				Stage:     name,
+				Value:     fmt.Sprint(r),
+				Stack:     string(debug.Stack()),
+				Timestamp: time.Now(),
+			})
+			supervisor.mutex.Unlock()
+			err = fmt.Errorf("%s hook panicked: %v", name, r)
+		}
+	}()
+
+	return hook()
+}
+
+// hookContext returns a copy of the context that carries the run and parameters of the supervisor to a lifecycle hook
+func (supervisor *Supervisor) hookContext(parent context.Context) context.Context {
+	run := supervisor.describe()
+	return cluster.WithRun(cluster.WithParameters(parent, run.Parameters), run)
+}
+
+// run
+// A single attempt at running the cluster, every attempt is given fresh channels and
+// a context that is cancelled once the attempt ends.
+func (supervisor *Supervisor) run() (response *cluster.Response) {
+	current := supervisor.newAttempt()
+	defer current.cancel()
+
 	defer func() {
 		if r := recover(); r != nil {
 			response = cluster.NewResponse(
 				supervisor.Config,
-				supervisor.Stats,
+				supervisor.Statistics(),
 				time.Now().Sub(supervisor.StartTime),
 				true,
 			)
 		}
 	}()
 
-	supervisor.StartTime = time.Now()
-
 	// start creating the default frontend goroutines
-	supervisor.Provision(cluster.Extract)
-	supervisor.waitGroup.Add(1)
-
-	for i := 0; i < supervisor.Config.StartWithNTransformClusters; i++ {
-		supervisor.Provision(cluster.Transform)
-		supervisor.waitGroup.Add(1)
-	}
-	for i := 0; i < supervisor.Config.StartWithNLoadClusters; i++ {
-		supervisor.Provision(cluster.Load)
-		supervisor.waitGroup.Add(1)
+	for _, s := range current.stages {
+		for i := 0; i < supervisor.initial(s); i++ {
+			supervisor.provision(current, s)
+		}
 	}
 	// end creating the default frontend goroutines
 
-	// every N seconds we should check if the etChannel or tlChannel is congested
+	supervisor.route(current)
+
+	// every N seconds we should check if the channel of a stage is congested
 	// and requires us to provision additional nodes
 	go supervisor.Runtime()
 
-	supervisor.waitGroup.Wait() // wait for the Extract-Transform-Load (ETL) Cycle to Complete
+	done := make(chan struct{})
+	go func() {
+		current.waitGroup.Wait() // wait for the Extract-Transform-Load (ETL) Cycle to Complete
+		close(done)
+	}()
+
+	cancelled, crashed := false, false
+	select {
+	case <-done:
+	case <-current.failed:
+		// a worker panicked and the config asks for the whole attempt to fail
+		crashed = true
+		current.cancel()
+		supervisor.drain(current)
+		supervisor.waitForStages(done)
+	case <-current.ctx.Done():
+		// an operator stopped the supervisor or the max-runtime passed
+		cancelled = true
+		supervisor.Event(Cancel)
+		supervisor.drain(current)
+		supervisor.waitForStages(done)
+	}
+
+	supervisor.recordChannelMetrics(current)
 
 	response = cluster.NewResponse(
 		supervisor.Config,
-		supervisor.Stats,
+		supervisor.Statistics(),
 		time.Now().Sub(supervisor.StartTime),
-		false,
+		crashed,
 	)
+	response.Cancelled = cancelled
 
 	return response
 }
 
+// waitForStages gives the stages a chance to return, stages that ignore the context are abandoned
+func (supervisor *Supervisor) waitForStages(done <-chan struct{}) {
+	select {
+	case <-done:
+	case <-time.After(DefaultCancelGracePeriod * time.Second):
+	}
+}
+
+// newAttempt
+// Replaces the channels, wait group and context used by the provisioned goroutines so that
+// goroutines left over from a crashed attempt cannot interfere with the next attempt.
+func (supervisor *Supervisor) newAttempt() *attempt {
+	pipeline := supervisor.pipeline()
+	stages := pipeline.Stages()
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	supervisor.Attempt++
+
+	current := new(attempt)
+	current.ctx, current.cancel = context.WithCancel(supervisor.ctx)
+	current.failed = make(chan struct{})
+	current.stages = make([]*stage, len(stages))
+	current.channels = make([]*channel.ManagedChannel, 0, len(stages))
+
+	for i, definition := range stages {
+		s := new(stage)
+		s.Stage = definition
+		s.index = i
+		current.stages[i] = s
+	}
+	supervisor.connect(current, pipeline)
+
+	// the input of a partitioned stage only feeds its partitions, the partitions time the envelopes
+	for _, s := range current.stages {
+		if (s.input != nil) && (s.Config.PartitionBy != nil) {
+			s.partitions = newPartitioner(s.Name, s.input, s.Config.PartitionBy)
+			s.input.Config.Name = ""
+		}
+	}
+
+	// the statistics of each stage are kept across attempts
+	if len(supervisor.Stats.Stages) != len(stages) {
+		supervisor.Stats.Stages = make([]cluster.StageStatistics, len(stages))
+		for i, definition := range stages {
+			supervisor.Stats.Stages[i].Name = definition.Name
+			supervisor.Stats.Stages[i].Segment = definition.Segment
+		}
+	}
+
+	supervisor.current = current
+	return current
+}
+
+// connect
+// Creates the channels between the stages of the attempt. Every transform and load stage
+// pulls from its own channel, several extract stages are given their own channel that is
+// merged into the head, and several load stages are fed from the tail by the router.
+func (supervisor *Supervisor) connect(current *attempt, pipeline *cluster.Pipeline) {
+	newChannel := func(name string, config cluster.StageConfig) *channel.ManagedChannel {
+		c := channel.NewManagedChannel(config.Threshold, config.GrowthFactor, config.Capacity)
+		c.Config.Name = name // envelopes pulled from the channel are timed against the stage
+		current.channels = append(current.channels, c)
+		return c
+	}
+	// channels that only feed a merge or the router are not scaled by a stage
+	routingConfig := cluster.StageConfig{Threshold: DefaultChannelThreshold, GrowthFactor: DefaultChannelGrowthFactor}
+
+	extracts, transforms, loads := make([]*stage, 0), make([]*stage, 0), make([]*stage, 0)
+	for _, s := range current.stages {
+		switch s.Segment {
+		case cluster.Extract:
+			extracts = append(extracts, s)
+		case cluster.Transform:
+			transforms = append(transforms, s)
+		default:
+			loads = append(loads, s)
+		}
+	}
+
+	for _, s := range loads {
+		s.input = newChannel(s.Name, s.Config)
+	}
+	if len(loads) == 1 {
+		current.tail = loads[0].input
+	} else {
+		current.tail = newChannel("", routingConfig)
+		current.router = pipeline.Router()
+	}
+
+	// the transform stages are chained together from the tail back to the head, in ordered mode
+	// the last transform stage pushes to the reorder buffer instead of the tail
+	downstream := current.tail
+	if supervisor.Config.Ordered {
+		size := supervisor.Config.ReorderBufferSize
+		if size <= 0 {
+			size = DefaultReorderBufferSize
+		}
+		current.sequence = newSequencer(newChannel("", routingConfig), current.tail, size)
+		downstream = current.sequence.input
+	}
+	for i := len(transforms) - 1; i >= 0; i-- {
+		transforms[i].output = downstream
+		transforms[i].input = newChannel(transforms[i].Name, transforms[i].Config)
+		downstream = transforms[i].input
+	}
+	current.head = downstream
+
+	for _, s := range extracts {
+		if len(extracts) == 1 {
+			s.output = current.head
+		} else {
+			s.output = newChannel("", routingConfig)
+			current.branches = append(current.branches, s.output)
+		}
+	}
+}
+
+// route starts the goroutines that merge the extract stages, partition stages by key, reorder and fan out to the load stages
+func (supervisor *Supervisor) route(current *attempt) {
+	if current.sequence != nil {
+		current.waitGroup.Add(1)
+		go func() {
+			defer current.waitGroup.Done()
+			current.sequence.run()
+		}()
+	}
+
+	for _, s := range current.stages {
+		if s.partitions != nil {
+			current.waitGroup.Add(1)
+			go func(p *partitioner) {
+				defer current.waitGroup.Done()
+				p.run()
+			}(s.partitions)
+		}
+	}
+
+	if len(current.branches) > 0 {
+		current.waitGroup.Add(1)
+		go func() {
+			defer current.waitGroup.Done()
+			channel.Merge(current.head, current.branches...)
+		}()
+	}
+
+	if current.router != nil {
+		outputs := make([]*channel.ManagedChannel, 0)
+		for _, s := range current.stages {
+			if s.Segment == cluster.Load {
+				outputs = append(outputs, s.input)
+			}
+		}
+
+		current.waitGroup.Add(1)
+		go func() {
+			defer current.waitGroup.Done()
+			channel.Route(current.tail, outputs, current.router)
+			// every load stage has returned, release whatever is still pushing to the tail
+			current.tail.Cancel()
+		}()
+	}
+}
+
+// pipeline returns the stages to run, a Cluster runs as the default extract, transform and load pipeline
+func (supervisor *Supervisor) pipeline() *cluster.Pipeline {
+	if pipeline, ok := supervisor.group.(*cluster.Pipeline); ok {
+		return pipeline
+	}
+	return cluster.NewDefaultPipeline(supervisor.group, supervisor.Config)
+}
+
+// currentAttempt returns the attempt that is running, or nil if the supervisor has not started
+func (supervisor *Supervisor) currentAttempt() *attempt {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return supervisor.current
+}
+
+// nextRestart
+// Decides whether a crashed cluster should be restarted and how long to back off for. The
+// backoff doubles for every restart made within the restart window.
+func (supervisor *Supervisor) nextRestart(restarts []time.Time) (backoff time.Duration, restart bool) {
+	if !supervisor.Config.RestartsOnCrash() {
+		return 0, false
+	}
+
+	maxRestarts := supervisor.Config.MaxRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = DefaultMaxRestarts
+	}
+
+	// only restarts that happened within the window count towards the limit
+	recent := 0
+	for _, restartedAt := range restarts {
+		if (supervisor.Config.RestartWindow <= 0) ||
+			(time.Now().Sub(restartedAt).Minutes() <= supervisor.Config.RestartWindow) {
+			recent++
+		}
+	}
+	if recent >= maxRestarts {
+		return 0, false
+	}
+
+	initialBackoff := supervisor.Config.RestartBackoff
+	if initialBackoff <= 0 {
+		initialBackoff = DefaultRestartBackoff
+	}
+	maxBackoff := supervisor.Config.MaxRestartBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxRestartBackoff
+	}
+
+	seconds := math.Min(initialBackoff*math.Pow(2, float64(recent)), maxBackoff)
+	return time.Duration(seconds * float64(time.Second)), true
+}
+
+// drain
+// Cancels the channels between the stages so that stages blocked on sending data downstream
+// are released and the data left in the channels is discarded.
+func (supervisor *Supervisor) drain(current *attempt) {
+	for _, c := range current.channels {
+		c.Cancel()
+	}
+	for _, s := range current.stages {
+		if s.partitions != nil {
+			s.partitions.cancel()
+		}
+	}
+}
+
+// recordChannelMetrics
+// Copies the instrumentation of the channels each stage pulls from and pushes to into the
+// statistics, the head and tail channels are also reported as the et and tl channels.
+func (supervisor *Supervisor) recordChannelMetrics(current *attempt) {
+	inputs := make([]channel.Metrics, len(current.stages))
+	outputs := make([]channel.Metrics, len(current.stages))
+	finished := make([]bool, len(current.stages))
+	partitions, rebalances := make([]int, len(current.stages)), make([]int, len(current.stages))
+
+	for i, s := range current.stages {
+		if s.input != nil {
+			inputs[i] = s.input.Metrics()
+		}
+		if s.partitions != nil {
+			partitions[i], rebalances[i] = s.partitions.size()
+		}
+		// the output of an extract stage is only its own when it is merged into the head
+		if (s.Segment == cluster.Extract) && (len(current.branches) > 0) {
+			outputs[i] = s.output.Metrics()
+		}
+	}
+	current.mutex.Lock()
+	for i, s := range current.stages {
+		finished[i] = s.finished
+	}
+	current.mutex.Unlock()
+	head, tail := current.head.Metrics(), current.tail.Metrics()
+	var size, occupancy, highWaterMark int
+	if current.sequence != nil {
+		size, occupancy, highWaterMark = current.sequence.occupancy()
+	}
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	for i := range current.stages {
+		supervisor.Stats.Stages[i].Input = inputs[i]
+		supervisor.Stats.Stages[i].Output = outputs[i]
+		supervisor.Stats.Stages[i].Finished = finished[i]
+		supervisor.Stats.Stages[i].Partitions = partitions[i]
+		supervisor.Stats.Stages[i].NumRebalances = rebalances[i]
+	}
+	supervisor.Stats.ETChannel = head
+	supervisor.Stats.TLChannel = tail
+	supervisor.Stats.ReorderBufferSize = size
+	supervisor.Stats.ReorderBufferOccupancy = occupancy
+	supervisor.Stats.ReorderBufferHighWaterMark = highWaterMark
+}
+
+func (supervisor *Supervisor) IsCancelled() bool {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return supervisor.State == Cancelled
+}
+
+// Stop
+// Cancels the context handed to every ContextCluster stage. Stages that implement the
+// original Cluster interface have no way of observing this and will run until completion.
+func (supervisor *Supervisor) Stop() {
+	supervisor.cancel()
+}
+
+// Terminate
+// Stops the supervisor because the node can no longer wait for it to complete, the
+// statistics of the run will record that it was terminated by the hard-terminate-time.
+func (supervisor *Supervisor) Terminate() {
+	supervisor.mutex.Lock()
+	supervisor.Stats.TerminatedByDeadline = true
+	supervisor.mutex.Unlock()
+
+	supervisor.Stop()
+}
+
+// Statistics returns a copy of the statistics of the supervisor, it is safe to read while the supervisor runs
+func (supervisor *Supervisor) Statistics() *cluster.Statistics {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return supervisor.Stats.Copy()
+}
+
+// DeadlineExceeded returns true if the supervisor was stopped because the max-runtime of its config passed
+func (supervisor *Supervisor) DeadlineExceeded() bool {
+	return errors.Is(supervisor.lifetime().Err(), context.DeadlineExceeded)
+}
+
+// IsActive returns true if the supervisor has started and has not yet reached an end state
+func (supervisor *Supervisor) IsActive() bool {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return (supervisor.State == Running) || (supervisor.State == Provisioning) || (supervisor.State == Restarting)
+}
+
+// IsComplete returns true once the supervisor has reached an end state, a supervisor that has not started is not complete
+func (supervisor *Supervisor) IsComplete() bool {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return (supervisor.State == Failed) || (supervisor.State == Terminated) || (supervisor.State == Cancelled)
+}
+
+// Context returns the context that is passed to ContextCluster stages of the current attempt
+func (supervisor *Supervisor) Context() context.Context {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	if supervisor.current == nil {
+		return supervisor.ctx
+	}
+	return supervisor.current.ctx
+}
+
+// lifetime returns the context that spans every attempt made by the supervisor
+func (supervisor *Supervisor) lifetime() context.Context {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return supervisor.ctx
+}
+
 func (supervisor *Supervisor) Runtime() {
+	current := supervisor.currentAttempt()
+	if current == nil {
+		return
+	}
+	ctx := current.ctx
+
+	// every stage that pulls from a channel is given its own instance of the policy named by the config
+	scalers := make([]*scaler, 0, len(current.stages))
+	for _, s := range current.stages {
+		if s.input != nil {
+			policy, _ := NewScalingPolicy(supervisor.Config) // the name was checked when the supervisor started
+			scalers = append(scalers, newScaler(s, policy))
+		}
+	}
+
 	for {
-		// is etChannel congested?
-		if supervisor.etChannel.State == channel.Congested {
-			supervisor.Stats.NumEtThresholdBreaches++
-			n := supervisor.Stats.NumProvisionedTransformRoutes
-			for n > 0 {
-				supervisor.Provision(cluster.Transform)
-				n--
-			}
-			supervisor.Stats.NumProvisionedTransformRoutes *= supervisor.etChannel.Config.GrowthFactor
+		// are the channels of the stages congested or idle?
+		for _, s := range scalers {
+			supervisor.autoscale(current, s)
 		}
 
-		// is tlChannel congested?
-		if supervisor.tlChannel.State == channel.Congested {
+		supervisor.recordChannelMetrics(current)
+
+		// check if the channels are congested after the monitor refresh duration
+		select {
+		case <-ctx.Done():
+			return // the supervisor has torn down or was stopped, nothing left to scale
+		case <-time.After(supervisor.refresh()):
+		}
+	}
+}
+
+// autoscale
+// Asks the scaling policy of the stage how many goroutines it should have, the answer is
+// kept within the stage limits and scaling in is held back until the cooldown has passed.
+func (supervisor *Supervisor) autoscale(current *attempt, s *scaler) {
+	now := time.Now()
+	metrics := s.stage.input.Metrics()
+
+	if metrics.State == channel.Congested {
+		supervisor.mutex.Lock()
+		supervisor.Stats.Stages[s.stage.index].NumThresholdBreaches++
+		if s.stage.Segment == cluster.Transform {
+			supervisor.Stats.NumEtThresholdBreaches++
+		} else {
 			supervisor.Stats.NumTlThresholdBreaches++
-			n := supervisor.Stats.NumProvisionedLoadRoutines
-			for n > 0 {
-				supervisor.Provision(cluster.Load)
-				n--
-			}
-			supervisor.Stats.NumProvisionedLoadRoutines *= supervisor.tlChannel.Config.GrowthFactor
 		}
+		supervisor.mutex.Unlock()
+	}
+
+	// the time the channel was first seen empty, reset whenever data units are waiting
+	if metrics.State != channel.Empty {
+		s.idleSince = time.Time{}
+	} else if s.idleSince.IsZero() {
+		s.idleSince = now
+	}
+
+	minimum, maximum := supervisor.limits(s.stage)
+	input := ScalingInput{
+		Stage:        s.stage.Name,
+		Segment:      s.stage.Segment,
+		Active:       current.numOfActive(s.stage),
+		Minimum:      minimum,
+		Maximum:      maximum,
+		Channel:      metrics,
+		Threshold:    s.stage.input.Config.Threshold,
+		GrowthFactor: s.stage.input.Config.GrowthFactor,
+		Interval:     now.Sub(s.lastTick),
+		Cooldown:     supervisor.cooldown(),
+	}
+	if !s.idleSince.IsZero() {
+		input.IdleFor = now.Sub(s.idleSince)
+	}
+	s.lastTick = now
+
+	desired, reason, ok := supervisor.desired(s, input)
+	if !ok {
+		return
+	}
+	if desired < minimum {
+		desired = minimum
+	} else if desired > maximum {
+		desired = maximum
+	}
+
+	if desired < input.Active {
+		if now.Sub(s.lastScaled) < input.Cooldown {
+			return
+		}
+		// the next scale down has to wait out another cooldown
+		s.idleSince = now
+	}
+
+	if desired != input.Active {
+		s.lastScaled = now
+		supervisor.scale(current, s.stage, input.Active, desired, reason)
+	}
+}
+
+// desired
+// Asks the policy of the stage how many goroutines it should have. A policy that panics is
+// recorded like a panicked worker and the stage falls back to the threshold policy.
+func (supervisor *Supervisor) desired(s *scaler, input ScalingInput) (desired int, reason string, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			supervisor.mutex.Lock()
+			supervisor.Panics = append(supervisor.Panics, WorkerPanic{
+				Attempt:   supervisor.Attempt,
+				Stage:     s.stage.Name,
+				Segment:   s.stage.Segment,
+				Value:     fmt.Sprintf("scaling policy: %v", r),
+				Stack:     string(debug.Stack()),
+				Timestamp: time.Now(),
+			})
+			supervisor.mutex.Unlock()
+
+			s.policy = new(thresholdScaling)
+			desired, reason, ok = input.Active, "", false
+		}
+	}()
+
+	desired, reason = s.policy.Desired(input)
+	return desired, reason, true
+}
+
+// scale provisions or retires goroutines of the stage until there are desired goroutines
+func (supervisor *Supervisor) scale(current *attempt, s *stage, active, desired int, reason string) {
+	if desired > active {
+		for i := active; i < desired; i++ {
+			supervisor.provision(current, s)
+		}
+	} else {
+		current.retire(s, active-desired)
+	}
+
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	if desired > active {
+		supervisor.Stats.NumScaleUps++
+	} else {
+		supervisor.Stats.NumScaleDowns++
+	}
+
+	// only the most recent events are kept so a long-running cluster does not grow its statistics forever
+	if len(supervisor.Stats.ScaleEvents) == MaxScaleEvents {
+		supervisor.Stats.ScaleEvents = supervisor.Stats.ScaleEvents[1:]
+	}
+	supervisor.Stats.ScaleEvents = append(supervisor.Stats.ScaleEvents, cluster.ScaleEvent{
+		Stage:     s.Name,
+		Segment:   s.Segment,
+		From:      active,
+		To:        desired,
+		Reason:    reason,
+		Timestamp: time.Now(),
+	})
+}
+
+// limits returns the minimum and maximum number of goroutines the stage can scale between
+func (supervisor *Supervisor) limits(s *stage) (minimum, maximum int) {
+	minimum, maximum = s.Config.MinRoutines, s.Config.MaxRoutines
+
+	if minimum <= 0 {
+		minimum = DefaultMinRoutines
+	}
+	if maximum <= 0 {
+		maximum = DefaultMaxRoutines
+	}
+	if maximum < minimum {
+		maximum = minimum
+	}
+	return minimum, maximum
+}
+
+// initial returns the number of goroutines the stage starts with, kept within the stage limits
+func (supervisor *Supervisor) initial(s *stage) int {
+	n := s.Config.StartWith
+
+	minimum, maximum := supervisor.limits(s)
+	if n < minimum {
+		return minimum
+	} else if n > maximum {
+		return maximum
+	}
+	return n
+}
 
-		// check if the channel is congested after DefaultMonitorRefreshDuration seconds
-		time.Sleep(DefaultMonitorRefreshDuration * time.Second)
+func (supervisor *Supervisor) refresh() time.Duration {
+	if supervisor.Config.MonitorRefreshDuration <= 0 {
+		return DefaultMonitorRefreshDuration * time.Second
 	}
+	return time.Duration(supervisor.Config.MonitorRefreshDuration * float64(time.Second))
 }
 
+func (supervisor *Supervisor) cooldown() time.Duration {
+	if supervisor.Config.ScaleDownCooldown <= 0 {
+		return DefaultScaleDownCooldown * time.Second
+	}
+	return time.Duration(supervisor.Config.ScaleDownCooldown * float64(time.Second))
+}
+
+// Provision starts another goroutine for the first stage of the segment
 func (supervisor *Supervisor) Provision(segment cluster.Segment) {
+	if current := supervisor.currentAttempt(); current != nil {
+		if s := current.first(segment); s != nil {
+			supervisor.provision(current, s)
+		}
+	}
+}
+
+// provision
+// Starts a goroutine for the stage that belongs to the attempt, if the supervisor restarts
+// the goroutine will be left with the channels and wait group of the attempt it was provisioned in.
+func (supervisor *Supervisor) provision(current *attempt, s *stage) {
+	ctx := current.ctx
+
+	// a cancelled supervisor should not be creating any new goroutines
+	if ctx.Err() != nil {
+		return
+	}
+
+	// once every goroutine of a stage has returned its output channel is closed, adding
+	// another goroutine to the stage would have it push to a closed channel
+	if !current.activate(s) {
+		return
+	}
+
 	supervisor.Event(StartProvision)
 	defer supervisor.Event(EndProvision)
 
+	supervisor.mutex.Lock()
+	switch s.Segment {
+	case cluster.Extract:
+		supervisor.Stats.NumProvisionedExtractRoutines++
+	case cluster.Transform:
+		supervisor.Stats.NumProvisionedTransformRoutes++
+	default:
+		supervisor.Stats.NumProvisionedLoadRoutines++
+	}
+	supervisor.Stats.Stages[s.index].NumProvisioned++
+	supervisor.mutex.Unlock()
+
+	// goroutines pull through their own receiver so they can be retired individually,
+	// the extract stage is given no input and the load stage no output
+	var output channel.OutputChannel
+	receiver, input := current.receiver(s)
+	if s.output != nil {
+		output = s.output
+	}
+
+	// in ordered mode the data units are numbered at extract and grouped by number through the transform stages
+	var sequence *ordered
+	if (current.sequence != nil) && (s.Segment != cluster.Load) {
+		sequence = newOrdered(current.ctx, current.sequence, input, output)
+		if input != nil {
+			input = sequence
+		}
+		output = sequence
+	}
+
+	// the data unit a transform or load goroutine was working on is accounted for if it panics
+	var held *holder
+	if input != nil {
+		held = newHolder(input)
+		input = held
+	}
+
+	// transform and load stages are given an error output for the data units they reject
+	if s.Segment != cluster.Extract {
+		ctx = cluster.WithErrorOutput(ctx, rejecter{supervisor: supervisor, stage: s})
+	}
+	ctx = cluster.WithRetrier(ctx, retrier{supervisor: supervisor, stage: s, policy: cluster.NewRetryPolicy(supervisor.Config)})
+	run := supervisor.describe()
+	ctx = cluster.WithParameters(ctx, run.Parameters)
+	ctx = cluster.WithRun(ctx, run)
+
+	setupWorker := cluster.HooksOf(supervisor.group).SetupWorker
+
+	current.waitGroup.Add(1)
+
 	go func() {
-		switch segment {
-		case cluster.Extract:
-			supervisor.Stats.NumProvisionedExtractRoutines++
-			supervisor.group.ExtractFunc(supervisor.etChannel.Channel)
-			break
-		case cluster.Transform: // transform
-			supervisor.Stats.NumProvisionedTransformRoutes++
-			supervisor.group.TransformFunc(supervisor.etChannel.Channel, supervisor.tlChannel.Channel)
-			break
-		default: // load
-			supervisor.Stats.NumProvisionedLoadRoutines++
-			supervisor.group.LoadFunc(supervisor.tlChannel.Channel)
-			break
+		var setupErr error
+
+		// notify the wait group a process has completed ~ if all are finished we close the monitor
+		defer current.waitGroup.Done()
+		defer current.deactivate(s, receiver)
+		// a panic in a single goroutine should not take down the node, the recovery is
+		// deferred last so a replacement is provisioned before the stage is deactivated
+		defer func() {
+			r := recover()
+			// a goroutine that could not be set up is handled as if it panicked
+			if (r == nil) && (setupErr != nil) {
+				r = fmt.Errorf("worker setup failed: %w", setupErr)
+			}
+			// whatever the goroutine pushed for the data unit it held is passed on, even if it panicked
+			if sequence != nil {
+				sequence.flush()
+			}
+
+			if r != nil {
+				// the replacement of the goroutine takes over its partition and keys
+				if s.partitions != nil {
+					s.partitions.leave(receiver)
+				}
+				supervisor.recoverWorker(current, s, held, r, debug.Stack())
+			}
+		}()
+
+		if setupWorker != nil {
+			if setupErr = setupWorker(ctx, s.Name); setupErr != nil {
+				return
+			}
 		}
-		supervisor.waitGroup.Done() // notify the wait group a process has completed ~ if all are finished we close the monitor
+
+		s.Run(ctx, input, output)
 	}()
 }
 
+// SetParameters records the runtime parameters the supervisor runs with, they should be set before it starts
+func (supervisor *Supervisor) SetParameters(parameters cluster.Parameters) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	supervisor.Parameters = parameters
+}
+
+// SetLogger sets the logger the stages log through, it should be set before the supervisor starts
+func (supervisor *Supervisor) SetLogger(logger cluster.Logger) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	supervisor.logger = logger
+}
+
+// SetCache sets the cache the stages save to and load from, it should be set before the supervisor starts
+func (supervisor *Supervisor) SetCache(cache cluster.Cache) {
+	supervisor.mutex.Lock()
+	defer supervisor.mutex.Unlock()
+
+	supervisor.cache = cache
+}
+
+// describe returns the run handed to a goroutine provisioned during the current attempt
+func (supervisor *Supervisor) describe() *cluster.Run {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	return &cluster.Run{
+		Supervisor: supervisor.Id,
+		Cluster:    supervisor.cluster,
+		Config:     supervisor.Config.Identifier,
+		Attempt:    supervisor.Attempt,
+		Parameters: supervisor.Parameters,
+		Logger:     supervisor.logger,
+		Cache:      supervisor.cache,
+		Metrics:    recorder{supervisor: supervisor},
+		Outputs:    recorder{supervisor: supervisor},
+	}
+}
+
+// outputs returns a copy of the outputs recorded by the stages, nil if there are none
+func (supervisor *Supervisor) outputs() map[string]any {
+	supervisor.mutex.RLock()
+	defer supervisor.mutex.RUnlock()
+
+	if len(supervisor.Outputs) == 0 {
+		return nil
+	}
+	outputs := make(map[string]any, len(supervisor.Outputs))
+	for name, value := range supervisor.Outputs {
+		outputs[name] = value
+	}
+	return outputs
+}
+
+func (r recorder) Add(name string, delta int64) {
+	r.supervisor.mutex.Lock()
+	defer r.supervisor.mutex.Unlock()
+
+	r.supervisor.Stats.Metrics.Add(name, delta)
+}
+
+func (r recorder) Set(name string, value float64) {
+	r.supervisor.mutex.Lock()
+	defer r.supervisor.mutex.Unlock()
+
+	r.supervisor.Stats.Metrics.Set(name, value)
+}
+
+func (r recorder) Observe(name string, value float64) {
+	r.supervisor.mutex.Lock()
+	defer r.supervisor.mutex.Unlock()
+
+	r.supervisor.Stats.Metrics.Observe(name, value)
+}
+
+func (r recorder) Output(name string, value any) {
+	r.supervisor.mutex.Lock()
+	defer r.supervisor.mutex.Unlock()
+
+	if r.supervisor.Outputs == nil {
+		r.supervisor.Outputs = make(map[string]any)
+	}
+	r.supervisor.Outputs[name] = value
+}
+
+// Reject sends a data unit the stage rejected to the dead-letter store of the cluster
+func (r rejecter) Reject(data channel.Message, err error) {
+	r.supervisor.reject(r.stage, data, err)
+}
+
+func (supervisor *Supervisor) reject(s *stage, data channel.Message, err error) {
+	description := "rejected"
+	if err != nil {
+		description = err.Error()
+	}
+
+	supervisor.mutex.Lock()
+	supervisor.Stats.NumRejected++
+	supervisor.Stats.Stages[s.index].NumRejected++
+	supervisor.mutex.Unlock()
+
+	if supervisor.deadLetters != nil {
+		supervisor.deadLetters.Add(deadletter.Record{
+			Cluster:    supervisor.Config.Identifier,
+			Supervisor: supervisor.Id,
+			Stage:      s.Name,
+			Error:      description,
+			Data:       data,
+			Timestamp:  time.Now(),
+		})
+	}
+}
+
+// Do
+// Attempts the operation until it succeeds, fails with an error that is not retryable, or
+// runs out of attempts. The data unit is dead-lettered if the operation never succeeds.
+func (r retrier) Do(ctx context.Context, data channel.Message, operation func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := operation(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if (attempt >= r.policy.MaxAttempts) || !r.policy.IsRetryable(err) || (ctx.Err() != nil) {
+			r.supervisor.retryFailed(r.stage, data, err)
+			return err
+		}
+
+		r.supervisor.mutex.Lock()
+		r.supervisor.Stats.NumRetries++
+		r.supervisor.Stats.Stages[r.stage.index].NumRetries++
+		r.supervisor.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			// the supervisor stopped while waiting to retry, the operation will not be attempted again
+			r.supervisor.retryFailed(r.stage, data, err)
+			return err
+		case <-time.After(r.policy.Delay(attempt)):
+		}
+	}
+}
+
+func (supervisor *Supervisor) retryFailed(s *stage, data channel.Message, err error) {
+	supervisor.mutex.Lock()
+	supervisor.Stats.NumRetryFailures++
+	supervisor.Stats.Stages[s.index].NumRetryFailures++
+	supervisor.mutex.Unlock()
+
+	// extract stages have no data unit to dead-letter
+	if data != nil {
+		supervisor.reject(s, data, err)
+	}
+}
+
+// Resubmit
+// Pushes a data unit to the channel the named stage pulls from, returns false if the
+// supervisor is not running the stage or the stage can no longer accept data units.
+func (supervisor *Supervisor) Resubmit(stageName string, data channel.Message) bool {
+	current := supervisor.currentAttempt()
+	if (current == nil) || (current.ctx.Err() != nil) {
+		return false
+	}
+
+	for _, s := range current.stages {
+		if (s.Name != stageName) || (s.input == nil) {
+			continue
+		}
+
+		current.mutex.Lock()
+		finished := s.finished
+		current.mutex.Unlock()
+
+		return !finished && s.input.Offer(data)
+	}
+	return false
+}
+
+// recoverWorker
+// Records the panic of a provisioned goroutine against the supervisor and applies the
+// on-worker-panic policy of the config.
+func (supervisor *Supervisor) recoverWorker(current *attempt, s *stage, held *holder, value any, stack []byte) {
+	supervisor.mutex.Lock()
+	supervisor.Panics = append(supervisor.Panics, WorkerPanic{
+		Attempt:   supervisor.Attempt,
+		Stage:     s.Name,
+		Segment:   s.Segment,
+		Value:     fmt.Sprint(value),
+		Stack:     string(stack),
+		Timestamp: time.Now(),
+	})
+	supervisor.Stats.NumWorkerPanics++
+	supervisor.mutex.Unlock()
+
+	policy := supervisor.Config.OnWorkerPanic
+	// a replaced extract starts over and pushes every data unit it already sent again, unless the config
+	// accepts at-least-once delivery the attempt is failed instead
+	if (policy == cluster.ReplaceWorker) && (s.Segment == cluster.Extract) && !supervisor.Config.ReplaceExtractWorkers {
+		policy = cluster.FailSupervisor
+	}
+	// a stage that batches or windows an ordered input panics the same way in every goroutine it is given
+	if err, isError := value.(error); isError && errors.Is(err, channel.ErrSequenced) {
+		policy = cluster.FailSupervisor
+	}
+	if policy == cluster.ReplaceWorker {
+		maxReplacements := supervisor.Config.MaxWorkerReplacements
+		if maxReplacements <= 0 {
+			maxReplacements = DefaultMaxWorkerReplacements
+		}
+
+		supervisor.mutex.Lock()
+		current.replacements++
+		exceeded := current.replacements > maxReplacements
+		supervisor.mutex.Unlock()
+
+		// a worker that keeps panicking is treated as a failure instead of being replaced forever
+		if exceeded {
+			policy = cluster.FailSupervisor
+		}
+	}
+
+	// the run carries on without the data unit the goroutine was working on
+	if (policy != cluster.FailSupervisor) && (held != nil) {
+		supervisor.dropHeld(s, held, value)
+	}
+
+	switch policy {
+	case cluster.ReplaceWorker:
+		supervisor.mutex.Lock()
+		supervisor.Stats.NumReplacedWorkers++
+		supervisor.mutex.Unlock()
+		supervisor.provision(current, s)
+	case cluster.FailSupervisor:
+		current.failOnce.Do(func() {
+			close(current.failed)
+		})
+	default: // ignore, the goroutine is simply not replaced
+	}
+}
+
+// dropHeld
+// Accounts for the data unit a goroutine was working on when it panicked, it is not passed on by
+// the goroutine that replaces it and is dead-lettered instead.
+func (supervisor *Supervisor) dropHeld(s *stage, held *holder, value any) {
+	data, holding := held.release()
+	if !holding {
+		return
+	}
+
+	supervisor.mutex.Lock()
+	supervisor.Stats.NumPanickedRecords++
+	supervisor.mutex.Unlock()
+
+	supervisor.reject(s, data, fmt.Errorf("worker panicked: %v", value))
+}
+
 func (supervisor *Supervisor) Print() {
 	fmt.Printf("Id: %d\n", supervisor.Id)
 	fmt.Printf("Cluster: %s\n", supervisor.Config.Identifier)
@@ -204,6 +1306,14 @@ func (status Status) String() string {
 		return "Failed"
 	case Terminated:
 		return "Terminated"
+	case Unknown:
+		return "Unknown"
+	case Cancelled:
+		return "Cancelled"
+	case Restarting:
+		return "Restarting"
+	case Queued:
+		return "Queued"
 	default:
 		return "None"
 	}
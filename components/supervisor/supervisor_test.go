@@ -0,0 +1,1023 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/GabeCordo/etl/components/channel"
+	"github.com/GabeCordo/etl/components/cluster"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testRecords = 10
+
+// counter is a context aware cluster that doubles integers, the transform panics on the
+// record matching panicOn until it has panicked maxPanics times
+type counter struct {
+	panicOn      int
+	maxPanics    int
+	panicExtract bool          // the first extract panics after pushing every record
+	idleFor      time.Duration // how long the extract waits after pushing every record
+
+	panics int
+	loaded int
+	mutex  sync.Mutex
+}
+
+func (c *counter) ExtractFunc(output channel.OutputChannel) {}
+
+func (c *counter) TransformFunc(input channel.InputChannel, output channel.OutputChannel) {}
+
+func (c *counter) LoadFunc(input channel.InputChannel) {}
+
+func (c *counter) ExtractFuncWithContext(ctx context.Context, output channel.OutputChannel) {
+	for i := 0; (i < testRecords) && (ctx.Err() == nil); i++ {
+		output.Push(i)
+	}
+
+	c.mutex.Lock()
+	shouldPanic := c.panicExtract
+	c.panicExtract = false
+	c.mutex.Unlock()
+
+	if shouldPanic {
+		panic("bad extract")
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.idleFor):
+	}
+}
+
+func (c *counter) TransformFuncWithContext(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+	for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+		c.mutex.Lock()
+		shouldPanic := (data.(int) == c.panicOn) && (c.panics < c.maxPanics)
+		if shouldPanic {
+			c.panics++
+		}
+		c.mutex.Unlock()
+
+		if shouldPanic {
+			panic("bad record")
+		}
+
+		output.Push(data.(int) * 2)
+	}
+}
+
+func (c *counter) LoadFuncWithContext(ctx context.Context, input channel.InputChannel) {
+	for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+		c.mutex.Lock()
+		c.loaded++
+		c.mutex.Unlock()
+	}
+}
+
+func testConfig(mode cluster.OnCrash, onWorkerPanic cluster.OnWorkerPanic) cluster.Config {
+	return cluster.Config{
+		Identifier:                  "counter",
+		Mode:                        &mode,
+		StartWithNTransformClusters: 1,
+		StartWithNLoadClusters:      1,
+		ETChannelThreshold:          DefaultChannelThreshold,
+		ETChannelGrowthFactor:       DefaultChannelGrowthFactor,
+		TLChannelThreshold:          DefaultChannelThreshold,
+		TLChannelGrowthFactor:       DefaultChannelGrowthFactor,
+		OnWorkerPanic:               onWorkerPanic,
+		MaxRestarts:                 1,
+		RestartBackoff:              0.01,
+	}
+}
+
+func TestSupervisorReplacesPanickedWorker(t *testing.T) {
+	implementation := &counter{panicOn: 3, maxPanics: 1}
+	registry := NewRegistry("counter", implementation)
+	supervisor := registry.CreateSupervisor(testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+
+	response := supervisor.Start()
+
+	if response.DidItCrash {
+		t.Error("a replaced worker should not crash the supervisor")
+	}
+	if len(supervisor.Panics) != 1 || supervisor.Stats.NumReplacedWorkers != 1 {
+		t.Errorf("expected 1 recorded panic and replacement, got %d and %d", len(supervisor.Panics), supervisor.Stats.NumReplacedWorkers)
+	}
+	// the record the worker panicked on is not loaded, it is counted and dead-lettered instead
+	if (implementation.loaded != testRecords-1) || (supervisor.Stats.NumPanickedRecords != 1) {
+		t.Errorf("expected %d loaded records and 1 panicked record, got %d and %d", testRecords-1, implementation.loaded, supervisor.Stats.NumPanickedRecords)
+	}
+	if records := registry.DeadLetters().List(); (len(records) != 1) || (records[0].Data != 3) || !strings.HasPrefix(records[0].Error, "worker panicked") {
+		t.Errorf("expected the record the worker panicked on to be dead-lettered, got %+v", records)
+	}
+}
+
+func TestSupervisorFailsPanickedExtract(t *testing.T) {
+	for _, replace := range []bool{false, true} {
+		implementation := &counter{panicOn: -1, panicExtract: true}
+		config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+		config.ReplaceExtractWorkers = replace
+		response := NewCustomSupervisor(implementation, config).Start()
+
+		// without the option the extract is not replaced, a replacement would push every record twice
+		if response.DidItCrash == replace {
+			t.Errorf("replace-extract-workers %t: expected a crash to be %t", replace, !replace)
+		}
+		if replace && (implementation.loaded != 2*testRecords) {
+			t.Errorf("expected the replaced extract to push every record again, got %d records", implementation.loaded)
+		}
+	}
+}
+
+func TestSupervisorRestartsFailedAttempt(t *testing.T) {
+	implementation := &counter{panicOn: 3, maxPanics: 1}
+	supervisor := NewCustomSupervisor(implementation, testConfig(cluster.Restart, cluster.FailSupervisor))
+
+	response := supervisor.Start()
+
+	if response.DidItCrash {
+		t.Error("the second attempt should have completed")
+	}
+	if supervisor.Attempt != 2 || supervisor.Stats.NumRestarts != 1 {
+		t.Errorf("expected 2 attempts and 1 restart, got %d and %d", supervisor.Attempt, supervisor.Stats.NumRestarts)
+	}
+}
+
+func TestSupervisorGivesUpAfterMaxRestarts(t *testing.T) {
+	implementation := &counter{panicOn: 3, maxPanics: 5}
+	supervisor := NewCustomSupervisor(implementation, testConfig(cluster.Restart, cluster.FailSupervisor))
+
+	response := supervisor.Start()
+
+	if !response.DidItCrash {
+		t.Error("the supervisor should report a crash once it runs out of restarts")
+	}
+	if supervisor.State != Failed {
+		t.Errorf("expected the supervisor to be Failed, got %s", supervisor.State)
+	}
+}
+
+func TestSupervisorRestartIsOptIn(t *testing.T) {
+	implementation := &counter{panicOn: 3, maxPanics: 1}
+	config := testConfig(cluster.Restart, cluster.FailSupervisor)
+	config.Mode = nil
+	supervisor := NewCustomSupervisor(implementation, config)
+
+	response := supervisor.Start()
+
+	if !response.DidItCrash || (supervisor.Stats.NumRestarts != 0) {
+		t.Errorf("a config without on-crash should not restart, got %d restarts", supervisor.Stats.NumRestarts)
+	}
+}
+
+func TestSupervisorRestartBackoff(t *testing.T) {
+	config := testConfig(cluster.Restart, cluster.FailSupervisor)
+	config.MaxRestarts = 3
+	config.RestartBackoff = 1
+	config.MaxRestartBackoff = 3
+	config.RestartWindow = 1
+	supervisor := &Supervisor{Config: config}
+
+	now := time.Now()
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		restarts := make([]time.Time, i)
+		for j := range restarts {
+			restarts[j] = now
+		}
+		if backoff, restart := supervisor.nextRestart(restarts); !restart || (backoff != expected) {
+			t.Errorf("restart %d: expected a backoff of %s, got %s (%t)", i+1, expected, backoff, restart)
+		}
+	}
+
+	recent := []time.Time{now, now, now}
+	if _, restart := supervisor.nextRestart(recent); restart {
+		t.Error("the supervisor should give up after max-restarts within the window")
+	}
+
+	// restarts older than the window no longer count towards the limit or the backoff
+	stale := []time.Time{now.Add(-2 * time.Minute), now.Add(-2 * time.Minute), now}
+	if backoff, restart := supervisor.nextRestart(stale); !restart || (backoff != 2*time.Second) {
+		t.Errorf("expected restarts outside the window to be forgotten, got %s (%t)", backoff, restart)
+	}
+
+	doNothing := cluster.OnCrash(cluster.DoNothing)
+	supervisor.Config.Mode = &doNothing
+	if _, restart := supervisor.nextRestart(nil); restart {
+		t.Error("a DoNothing config should never restart")
+	}
+
+	// restarts are opt-in, a config without on-crash only reports the crash
+	supervisor.Config.Mode = nil
+	if _, restart := supervisor.nextRestart(nil); restart {
+		t.Error("a config without on-crash should never restart")
+	}
+}
+
+func TestStatusValues(t *testing.T) {
+	// the statuses are serialized as integers, new ones are appended so the existing values never change
+	for status, expected := range map[Status]uint8{UnTouched: 0, Running: 1, Provisioning: 2, Failed: 3, Terminated: 4, Unknown: 5} {
+		if uint8(status) != expected {
+			t.Errorf("expected %s to be %d, got %d", status, expected, status)
+		}
+	}
+	for _, status := range []Status{Unknown, Cancelled, Restarting, Queued} {
+		if status.String() == "None" {
+			t.Errorf("expected status %d to have a name", status)
+		}
+	}
+}
+
+func TestSupervisorCancel(t *testing.T) {
+	implementation := &counter{idleFor: time.Minute}
+	supervisor := NewCustomSupervisor(implementation, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+
+	responses := make(chan *cluster.Response, 1)
+	go func() { responses <- supervisor.Start() }()
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		implementation.mutex.Lock()
+		loaded := implementation.loaded
+		implementation.mutex.Unlock()
+		if loaded == testRecords {
+			break
+		}
+	}
+	supervisor.Stop()
+
+	select {
+	case response := <-responses:
+		if !response.Cancelled || response.DeadlineExceeded || response.DidItCrash || (supervisor.State != Cancelled) {
+			t.Errorf("expected the supervisor to finish cancelled, got %s", supervisor.State)
+		}
+		if (response.Stats == nil) || (response.Stats.NumProvisionedLoadRoutines == 0) || (implementation.loaded != testRecords) {
+			t.Error("expected the partial statistics of the run in the response")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the supervisor did not stop once it was cancelled")
+	}
+	if !supervisor.IsComplete() {
+		t.Error("a cancelled supervisor should be complete")
+	}
+}
+
+// declaredCounter is a counter that also declares parameters and partitions its transform
+type declaredCounter struct{ *counter }
+
+func (c declaredCounter) Parameters() []cluster.ParameterSpec {
+	return []cluster.ParameterSpec{{Name: "limit", Type: cluster.IntParameter}}
+}
+
+func (c declaredCounter) PartitionKey(data channel.Message) string {
+	return fmt.Sprint(data.(int) % 2)
+}
+
+func TestSupervisorDeadlineExceeded(t *testing.T) {
+	implementation := &counter{panicOn: -1, idleFor: time.Minute}
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.MaxRuntime = 0.01 // minutes
+	supervisor := NewCustomSupervisor(cluster.WithContext(declaredCounter{implementation}), config)
+
+	// the optional interfaces are found through the adapter of a context aware cluster
+	if _, declared := cluster.SchemaOf(supervisor.group); !declared {
+		t.Error("expected the schema of the cluster to be found through the adapter")
+	}
+	if pipeline := cluster.NewDefaultPipeline(supervisor.group, config); pipeline.Stages()[1].Config.PartitionBy == nil {
+		t.Error("expected the transform to be partitioned through the adapter")
+	}
+
+	response := supervisor.Start()
+	if !response.Cancelled || !response.DeadlineExceeded {
+		t.Errorf("expected the run to be cancelled by its deadline, got %+v", response)
+	}
+
+	stopped := NewCustomSupervisor(&counter{panicOn: -1, idleFor: time.Minute}, config)
+	time.AfterFunc(10*time.Millisecond, stopped.Stop)
+	if response := stopped.Start(); !response.Cancelled || response.DeadlineExceeded {
+		t.Error("a run stopped by an operator should not be reported as exceeding its deadline")
+	}
+}
+
+func TestSupervisorRetiresIdleWorkers(t *testing.T) {
+	implementation := &counter{panicOn: -1, idleFor: 2500 * time.Millisecond}
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.StartWithNTransformClusters = 4
+	config.ScaleDownCooldown = 0.1
+	supervisor := NewCustomSupervisor(implementation, config)
+
+	supervisor.Start()
+
+	if supervisor.Stats.NumScaleDowns == 0 {
+		t.Fatal("expected the idle transform goroutines to be scaled down")
+	}
+	for _, event := range supervisor.Stats.ScaleEvents {
+		if event.To < DefaultMinRoutines {
+			t.Errorf("scaled %d below the minimum to %d goroutines", event.Segment, event.To)
+		}
+	}
+	if implementation.loaded != testRecords {
+		t.Errorf("expected %d loaded records, got %d", testRecords, implementation.loaded)
+	}
+}
+
+type fixedScaling struct{ n int }
+
+func (policy fixedScaling) Desired(input ScalingInput) (int, string) {
+	return policy.n, "fixed"
+}
+
+func TestScalingPolicies(t *testing.T) {
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	congested := ScalingInput{Active: 2, GrowthFactor: 3, Channel: channel.Metrics{State: channel.Congested}}
+
+	config.ScalingPolicy = LinearPolicy
+	config.ScalingStep = 2
+	if policy, found := NewScalingPolicy(config); !found {
+		t.Fatal("the linear policy should be built in")
+	} else if desired, _ := policy.Desired(congested); desired != 4 {
+		t.Errorf("expected the linear policy to step to 4 goroutines, got %d", desired)
+	}
+
+	config.ScalingPolicy = ""
+	if policy, _ := NewScalingPolicy(config); policy == nil {
+		t.Fatal("expected the threshold policy to be the default")
+	} else if desired, _ := policy.Desired(congested); desired != 6 {
+		t.Errorf("expected the threshold policy to grow to 6 goroutines, got %d", desired)
+	}
+
+	// the registry is global, so the policy may already be registered by an earlier run of the test
+	RegisterScalingPolicy("fixed", func(config cluster.Config) ScalingPolicy { return fixedScaling{n: 7} })
+	if RegisterScalingPolicy("fixed", func(config cluster.Config) ScalingPolicy { return fixedScaling{} }) {
+		t.Error("a policy should only be registered once")
+	}
+	if RegisterScalingPolicy(ThresholdPolicy, func(config cluster.Config) ScalingPolicy { return fixedScaling{} }) {
+		t.Error("a built in policy should not be replaced")
+	}
+
+	config.ScalingPolicy = "fixed"
+	if policy, found := NewScalingPolicy(config); !found {
+		t.Fatal("expected the custom policy to be found")
+	} else if desired, _ := policy.Desired(congested); desired != 7 {
+		t.Errorf("expected the custom policy to be used, got %d", desired)
+	}
+}
+
+type panickingScaling struct{}
+
+func (policy panickingScaling) Desired(input ScalingInput) (int, string) {
+	panic("bad policy")
+}
+
+func TestScalingPolicyPanics(t *testing.T) {
+	RegisterScalingPolicy("panicking", func(config cluster.Config) ScalingPolicy { return panickingScaling{} })
+
+	implementation := &counter{panicOn: -1, idleFor: 1500 * time.Millisecond}
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.ScalingPolicy = "panicking"
+	supervisor := NewCustomSupervisor(implementation, config)
+
+	if response := supervisor.Start(); response.DidItCrash {
+		t.Error("a panicking scaling policy should not crash the supervisor")
+	}
+	if (len(supervisor.Panics) == 0) || (implementation.loaded != testRecords) {
+		t.Errorf("expected the panic to be recorded and every record loaded, got %d panics and %d records", len(supervisor.Panics), implementation.loaded)
+	}
+
+	config.ScalingPolicy = "misspelled"
+	if response := NewCustomSupervisor(&counter{panicOn: -1}, config).Start(); !response.DidItCrash {
+		t.Error("a supervisor naming an unknown scaling policy should not run")
+	}
+}
+
+func TestSupervisorRunsPipeline(t *testing.T) {
+	var mutex sync.Mutex
+	sum := 0
+
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < testRecords; i++ {
+				output.Push(i)
+			}
+		}).
+		Transform("increment", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				output.Push(data.(int) + 1)
+			}
+		}).
+		Transform("double", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				output.Push(data.(int) * 2)
+			}
+		}, cluster.StageConfig{StartWith: 2}).
+		Load("sum", func(ctx context.Context, input channel.InputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				mutex.Lock()
+				sum += data.(int)
+				mutex.Unlock()
+			}
+		})
+
+	supervisor := NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response := supervisor.Start()
+
+	if response.DidItCrash {
+		t.Fatal("the pipeline should not crash")
+	}
+	if sum != 110 {
+		t.Errorf("expected every record to pass through each stage, got a sum of %d", sum)
+	}
+	if len(supervisor.Stats.Stages) != 4 || supervisor.Stats.Stages[2].NumProvisioned != 2 {
+		t.Errorf("expected statistics for 4 stages with 2 double goroutines, got %+v", supervisor.Stats.Stages)
+	}
+}
+
+func TestSupervisorFansInAndOut(t *testing.T) {
+	var mutex sync.Mutex
+	loaded := make(map[string]int)
+
+	extract := func(ctx context.Context, output channel.OutputChannel) {
+		for i := 0; i < testRecords; i++ {
+			output.Push(i)
+		}
+	}
+	load := func(name string) cluster.LoadStage {
+		return func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+				mutex.Lock()
+				loaded[name]++
+				mutex.Unlock()
+			}
+		}
+	}
+	parity := func(data channel.Message) string {
+		if data.(int)%2 == 0 {
+			return "even"
+		}
+		return "odd"
+	}
+
+	pipeline := cluster.NewPipeline().
+		Extract("first", extract).
+		Extract("second", extract).
+		Load("even", load("even")).
+		Load("odd", load("odd")).
+		FanOut(cluster.ByKey, parity)
+
+	supervisor := NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response := supervisor.Start()
+
+	if response.DidItCrash {
+		t.Fatal("the pipeline should not crash")
+	}
+	if (loaded["even"] != testRecords) || (loaded["odd"] != testRecords) {
+		t.Errorf("expected %d records routed to each load stage, got %v", testRecords, loaded)
+	}
+	for _, stage := range supervisor.Stats.Stages {
+		if !stage.Finished {
+			t.Errorf("expected the %s stage to have finished", stage.Name)
+		}
+	}
+	if supervisor.Stats.Stages[0].Output.Enqueued != testRecords {
+		t.Errorf("expected the first extract branch to report its own channel, got %+v", supervisor.Stats.Stages[0].Output)
+	}
+}
+
+func TestSupervisorDeadLettersRejectedRecords(t *testing.T) {
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < testRecords; i++ {
+				output.Push(i)
+			}
+		}).
+		Transform("evens", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				if data.(int)%2 == 1 {
+					cluster.Reject(ctx, data, errors.New("odd number"))
+					continue
+				}
+				output.Push(data)
+			}
+		}).
+		Load("discard", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+			}
+		})
+
+	registry := NewRegistry("evens", pipeline)
+	supervisor := registry.CreateSupervisor(testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	supervisor.Start()
+
+	records := registry.DeadLetters().List()
+	if (len(records) != testRecords/2) || (supervisor.Stats.NumRejected != testRecords/2) {
+		t.Fatalf("expected %d dead-lettered records, got %d", testRecords/2, len(records))
+	}
+	if (records[0].Stage != "evens") || (records[0].Error != "odd number") || (records[0].Supervisor != supervisor.Id) {
+		t.Errorf("the record does not describe where it was rejected, got %+v", records[0])
+	}
+	if success, _ := registry.Resubmit(records[0].Id); success {
+		t.Error("a record should not be re-submitted once every supervisor has finished")
+	}
+}
+
+func TestSupervisorResubmitsDeadLetters(t *testing.T) {
+	var mutex sync.Mutex
+	rejected, loaded := false, 0
+	release := make(chan struct{})
+
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			output.Push(1)
+			// the supervisor keeps running until the record has been re-submitted
+			<-release
+		}).
+		Transform("once", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				mutex.Lock()
+				reject := !rejected
+				rejected = true
+				mutex.Unlock()
+				if reject {
+					cluster.Reject(ctx, data, errors.New("downstream unavailable"))
+					continue
+				}
+				output.Push(data)
+			}
+		}).
+		Load("count", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+				mutex.Lock()
+				loaded++
+				mutex.Unlock()
+			}
+		})
+
+	registry := NewRegistry("once", pipeline)
+	supervisor := registry.CreateSupervisor(testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	done := make(chan *cluster.Response)
+	go func() { done <- supervisor.Start() }()
+
+	for registry.DeadLetters().Size() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	id := registry.DeadLetters().List()[0].Id
+	if success, description := registry.Resubmit(id); !success {
+		t.Fatalf("expected the record to be re-submitted to the running supervisor, got %s", description)
+	}
+	close(release)
+	<-done
+
+	if (loaded != 1) || (registry.DeadLetters().Size() != 0) {
+		t.Errorf("expected the re-submitted record to be loaded and removed from the store, got %d loaded", loaded)
+	}
+	if _, description := registry.Resubmit(id); description != "record not found" {
+		t.Errorf("expected a record to only be re-submitted once, got %q", description)
+	}
+}
+
+func TestSupervisorRetriesFailedOperations(t *testing.T) {
+	var mutex sync.Mutex
+	attempts := make(map[int]int)
+
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < testRecords; i++ {
+				output.Push(i)
+			}
+		}).
+		Load("flaky", func(ctx context.Context, input channel.InputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				cluster.Retry(ctx, data, func(ctx context.Context) error {
+					mutex.Lock()
+					defer mutex.Unlock()
+
+					attempts[data.(int)]++
+					if data.(int) == 7 {
+						return cluster.Permanent(errors.New("bad record"))
+					} else if attempts[data.(int)] == 1 {
+						return errors.New("connection reset")
+					}
+					return nil
+				})
+			}
+		})
+
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.RetryMaxAttempts = 3
+	config.RetryBackoff = 0.001
+
+	registry := NewRegistry("flaky", pipeline)
+	supervisor := registry.CreateSupervisor(config)
+	supervisor.Start()
+
+	if supervisor.Stats.NumRetries != testRecords-1 {
+		t.Errorf("expected every record but the permanent failure to be retried once, got %d retries", supervisor.Stats.NumRetries)
+	}
+	if (supervisor.Stats.NumRetryFailures != 1) || (registry.DeadLetters().Size() != 1) {
+		t.Errorf("expected the permanent failure to be dead-lettered, got %d failures", supervisor.Stats.NumRetryFailures)
+	}
+}
+
+func TestSupervisorPartitionsByKey(t *testing.T) {
+	const records, keys = 400, 3
+	type record struct{ key, sequence int }
+
+	var mutex sync.Mutex
+	last, busy := make(map[int]int), make(map[int]bool)
+	outOfOrder, concurrent, loaded := 0, 0, 0
+
+	var supervisor *Supervisor
+	pipeline := cluster.NewPipeline().
+		Extract("records", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < records; i++ {
+				// goroutines joining while records are in flight force the keys to be rebalanced
+				if i == records/2 {
+					for waiting := true; waiting; {
+						time.Sleep(time.Millisecond)
+						mutex.Lock()
+						waiting = loaded < records/4
+						mutex.Unlock()
+					}
+					supervisor.Provision(cluster.Transform)
+					supervisor.Provision(cluster.Transform)
+				}
+				output.Push(record{key: i % keys, sequence: i})
+			}
+		}).
+		Transform("aggregate", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				r := data.(record)
+				mutex.Lock()
+				previous, seen := last[r.key]
+				if seen && (previous > r.sequence) {
+					outOfOrder++
+				}
+				if busy[r.key] {
+					concurrent++
+				}
+				last[r.key], busy[r.key] = r.sequence, true
+				mutex.Unlock()
+
+				time.Sleep(50 * time.Microsecond)
+
+				mutex.Lock()
+				busy[r.key] = false
+				mutex.Unlock()
+				output.Push(r)
+			}
+		}, cluster.StageConfig{StartWith: 3, PartitionBy: func(data channel.Message) string {
+			return fmt.Sprint(data.(record).key)
+		}}).
+		Load("count", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+				mutex.Lock()
+				loaded++
+				mutex.Unlock()
+			}
+		})
+
+	supervisor = NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	supervisor.Start()
+
+	if loaded != records {
+		t.Errorf("expected %d loaded records, got %d", records, loaded)
+	}
+	if (outOfOrder != 0) || (concurrent != 0) {
+		t.Errorf("expected the records of every key in order one at a time, %d were out of order and %d concurrent", outOfOrder, concurrent)
+	}
+	if stats := supervisor.Stats.Stages[1]; (stats.Partitions != stats.NumProvisioned) || (stats.NumRebalances < 2) {
+		t.Errorf("expected the keys to be rebalanced as goroutines joined, got %+v", stats)
+	}
+}
+
+func TestSupervisorKeepsOrder(t *testing.T) {
+	const records = 300
+	received := make([]int, 0)
+
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < records; i++ {
+				output.Push(i)
+			}
+		}).
+		Transform("shuffle", func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				i := data.(int)
+				// the goroutines finish out of order, multiples of 7 are filtered and of 5 duplicated
+				time.Sleep(time.Duration(i%4) * 100 * time.Microsecond)
+				if i%7 == 0 {
+					continue
+				}
+				output.Push(i)
+				if i%5 == 0 {
+					output.Push(i)
+				}
+			}
+		}, cluster.StageConfig{StartWith: 4}).
+		Load("collect", func(ctx context.Context, input channel.InputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				received = append(received, data.(int))
+			}
+		})
+
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.Ordered = true
+	config.ReorderBufferSize = 8
+	supervisor := NewCustomSupervisor(pipeline, config)
+	supervisor.Start()
+
+	expected := make([]int, 0)
+	for i := 0; i < records; i++ {
+		if i%7 != 0 {
+			expected = append(expected, i)
+			if i%5 == 0 {
+				expected = append(expected, i)
+			}
+		}
+	}
+	if fmt.Sprint(received) != fmt.Sprint(expected) {
+		t.Errorf("expected the records in source order, got %v", received)
+	}
+	if (supervisor.Stats.ReorderBufferSize != 8) || (supervisor.Stats.ReorderBufferHighWaterMark >= 8) {
+		t.Errorf("expected the reorder buffer to stay within its size, got %+v", supervisor.Stats)
+	}
+}
+
+func TestSupervisorBatchesOrderedOutput(t *testing.T) {
+	var mutex sync.Mutex
+	received := make([]int, 0)
+	batched := func(ctx context.Context, input channel.InputChannel, output channel.OutputChannel) {
+		reader := channel.NewBatchReader(input, 4, 0)
+		for batch, ok := reader.Next(); ok; batch, ok = reader.Next() {
+			for _, data := range batch {
+				output.Push(data)
+			}
+		}
+	}
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < testRecords; i++ {
+				output.Push(i)
+			}
+		}).
+		Transform("batched", batched).
+		Load("discard", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+			}
+		})
+
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.Ordered = true
+	supervisor := NewCustomSupervisor(pipeline, config)
+	response := supervisor.Start()
+
+	// the batch reader would pull ahead of what the transform pushes for, the attempt fails instead of being replaced
+	if !response.DidItCrash || (len(supervisor.Panics) != 1) || (supervisor.Panics[0].Value != channel.ErrSequenced.Error()) {
+		t.Errorf("expected batching an ordered transform input to fail the attempt, got %+v", supervisor.Panics)
+	}
+
+	// a load stage is not numbered and can batch its input
+	pipeline = cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			for i := 0; i < testRecords; i++ {
+				output.Push(i)
+			}
+		}).
+		Load("collect", func(ctx context.Context, input channel.InputChannel) {
+			reader := channel.NewBatchReader(input, 4, 0)
+			for batch, ok := reader.Next(); ok; batch, ok = reader.Next() {
+				mutex.Lock()
+				for _, data := range batch {
+					received = append(received, data.(int))
+				}
+				mutex.Unlock()
+			}
+		})
+
+	supervisor = NewCustomSupervisor(pipeline, config)
+	if response := supervisor.Start(); response.DidItCrash || (len(received) != testRecords) {
+		t.Errorf("expected the load stage to batch every record, got %v", received)
+	}
+}
+
+func TestSupervisorPassesParameters(t *testing.T) {
+	sum := 0
+
+	pipeline := cluster.NewPipeline().
+		Declare(
+			cluster.ParameterSpec{Name: "limit", Type: cluster.IntParameter, Required: true},
+			cluster.ParameterSpec{Name: "from", Type: cluster.TimeParameter, Default: "2024-01-01"},
+		).
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			limit, _ := cluster.ParametersFromContext(ctx).Int("limit")
+			for i := 0; i < limit; i++ {
+				output.Push(i)
+			}
+		}).
+		Load("sum", func(ctx context.Context, input channel.InputChannel) {
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				sum += data.(int)
+			}
+		})
+
+	if _, valid, _ := cluster.ValidateParameters(pipeline, cluster.Parameters{"limit": 1.5}); valid {
+		t.Error("a fractional limit should not be accepted as an int")
+	}
+	if _, valid, _ := cluster.ValidateParameters(pipeline, cluster.Parameters{"limit": 1.0, "tenant": "a"}); valid {
+		t.Error("a parameter missing from the schema should not be accepted")
+	}
+
+	// JSON numbers are decoded as floats
+	parameters, valid, description := cluster.ValidateParameters(pipeline, cluster.Parameters{"limit": 5.0})
+	if !valid {
+		t.Fatalf("expected the parameters to be valid, got %s", description)
+	}
+	if from, _ := parameters.Time("from"); from.Year() != 2024 {
+		t.Errorf("expected the default to be applied, got %v", parameters)
+	}
+
+	supervisor := NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	supervisor.SetParameters(parameters)
+	response := supervisor.Start()
+
+	if sum != 10 {
+		t.Errorf("expected the extract stage to read the limit, got a sum of %d", sum)
+	}
+	if limit, _ := response.Parameters.Int("limit"); limit != 5 {
+		t.Errorf("expected the response to record the parameters, got %v", response.Parameters)
+	}
+}
+
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (logger *recordingLogger) Log(message string) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+
+	logger.messages = append(logger.messages, message)
+}
+
+func (logger *recordingLogger) Warning(message string) { logger.Log(message) }
+
+func (logger *recordingLogger) Fatal(message string) { logger.Log(message) }
+
+func TestSupervisorInjectsRun(t *testing.T) {
+	logger := new(recordingLogger)
+
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			run, _ := cluster.RunFromContext(ctx)
+			run.Log(fmt.Sprintf("%s:%s:%d", run.Cluster, run.Config, run.Supervisor))
+			for i := 0; i < 50; i++ {
+				output.Push(i)
+			}
+		}).
+		Load("count", func(ctx context.Context, input channel.InputChannel) {
+			run, _ := cluster.RunFromContext(ctx)
+			for data, ok := input.Pull(); ok; data, ok = input.Pull() {
+				run.Count("rows", 1)
+				run.Observe("value", float64(data.(int)))
+			}
+			run.Gauge("last-batch", 50)
+			run.Output("rows", 50)
+		})
+
+	registry := NewRegistry("numbers", pipeline)
+	config := testConfig(cluster.DoNothing, cluster.ReplaceWorker)
+	config.Identifier = "numbers-nightly"
+
+	supervisor := registry.CreateSupervisor(config)
+	supervisor.SetLogger(logger)
+	response := supervisor.Start()
+
+	expected := fmt.Sprintf("numbers:numbers-nightly:%d", supervisor.Id)
+	if (len(logger.messages) != 1) || (logger.messages[0] != expected) {
+		t.Errorf("expected the run to log %s through the supervisor, got %v", expected, logger.messages)
+	}
+	metrics := response.Stats.Metrics
+	if (metrics.Counters["rows"] != 50) || (metrics.Gauges["last-batch"] != 50) {
+		t.Errorf("expected 50 rows to be counted, got %v and %v", metrics.Counters, metrics.Gauges)
+	}
+	// 0 and 1 fall into the first bucket, 2 through 5 into the second
+	if value := metrics.Histograms["value"]; (value.Count != 50) || (value.Max != 49) || (value.Counts[0] != 2) || (value.Counts[1] != 4) {
+		t.Errorf("expected the values to be observed into the default buckets, got %+v", value)
+	}
+	if response.Outputs["rows"] != 50 {
+		t.Errorf("expected the response to record the outputs, got %v", response.Outputs)
+	}
+
+	// a supervisor created outside of a registry is named after the identifier of its config
+	logger = new(recordingLogger)
+	supervisor = NewCustomSupervisor(pipeline, config)
+	supervisor.SetLogger(logger)
+	supervisor.Start()
+
+	if (len(logger.messages) != 1) || (logger.messages[0] != "numbers-nightly:numbers-nightly:0") {
+		t.Errorf("expected the run to be named after its config, got %v", logger.messages)
+	}
+
+	if run, ok := cluster.RunFromContext(context.Background()); ok || (run == nil) {
+		t.Error("expected an empty run outside of a supervisor")
+	}
+}
+
+func TestSupervisorRunsLifecycleHooks(t *testing.T) {
+	var mutex sync.Mutex
+	calls := make(map[string]int)
+	record := func(name string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		calls[name]++
+	}
+
+	hooks := cluster.Hooks{
+		Setup:    func(ctx context.Context) error { record("setup"); return nil },
+		Teardown: func(ctx context.Context) error { record("teardown"); return nil },
+		SetupWorker: func(ctx context.Context, stage string) error {
+			record("worker")
+			return nil
+		},
+		OnFailure: func(ctx context.Context, response *cluster.Response) { record("failure") },
+	}
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			record("extract")
+			output.Push(1)
+		}).
+		Load("discard", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+			}
+		}).
+		Hooks(hooks)
+
+	supervisor := NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response := supervisor.Start()
+
+	provisioned := 0
+	for _, stage := range response.Stats.Stages {
+		provisioned += stage.NumProvisioned
+	}
+	if (calls["setup"] != 1) || (calls["teardown"] != 1) || (calls["failure"] != 0) || (calls["worker"] != provisioned) {
+		t.Errorf("expected setup and teardown once and a worker setup per goroutine, got %v", calls)
+	}
+
+	// a failed setup stops the run before any stage starts
+	calls = make(map[string]int)
+	hooks.Setup = func(ctx context.Context) error { return errors.New("database unreachable") }
+	pipeline.Hooks(hooks)
+
+	supervisor = NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response = supervisor.Start()
+
+	if (calls["extract"] != 0) || (calls["teardown"] != 0) || (calls["failure"] != 1) {
+		t.Errorf("expected only the failure hook to be called, got %v", calls)
+	}
+	if (response.SetupError != "database unreachable") || (supervisor.State != Failed) {
+		t.Errorf("expected the setup error to be reported, got %q in state %d", response.SetupError, supervisor.State)
+	}
+}
+
+func TestSupervisorRecoversPanickingHooks(t *testing.T) {
+	extracted := false
+	hooks := cluster.Hooks{
+		Setup:     func(ctx context.Context) error { panic("no connection string") },
+		OnFailure: func(ctx context.Context, response *cluster.Response) { panic("alerting is down") },
+	}
+	pipeline := cluster.NewPipeline().
+		Extract("numbers", func(ctx context.Context, output channel.OutputChannel) {
+			extracted = true
+			output.Push(1)
+		}).
+		Load("discard", func(ctx context.Context, input channel.InputChannel) {
+			for _, ok := input.Pull(); ok; _, ok = input.Pull() {
+			}
+		}).
+		Hooks(hooks)
+
+	supervisor := NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response := supervisor.Start()
+
+	if extracted || (supervisor.State != Failed) || !strings.Contains(response.SetupError, "no connection string") {
+		t.Errorf("expected a panicking setup to fail the run, got %q in state %d", response.SetupError, supervisor.State)
+	}
+	if (len(supervisor.Panics) != 2) || (supervisor.Panics[0].Stage != "setup") || (supervisor.Panics[1].Stage != "on-failure") {
+		t.Errorf("expected the setup and failure hook panics to be recorded, got %+v", supervisor.Panics)
+	}
+
+	// a panicking teardown is reported without failing a run that completed
+	hooks.Setup = nil
+	hooks.Teardown = func(ctx context.Context) error { panic("connection already closed") }
+	pipeline.Hooks(hooks)
+
+	supervisor = NewCustomSupervisor(pipeline, testConfig(cluster.DoNothing, cluster.ReplaceWorker))
+	response = supervisor.Start()
+
+	if !extracted || response.DidItCrash || !strings.Contains(response.TeardownError, "connection already closed") {
+		t.Errorf("expected the teardown panic to be reported, got %q", response.TeardownError)
+	}
+}
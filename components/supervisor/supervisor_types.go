@@ -1,8 +1,10 @@
 package supervisor
 
 import (
+	"context"
 	"github.com/GabeCordo/etl/components/channel"
 	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/deadletter"
 	"sync"
 	"time"
 )
@@ -20,6 +22,9 @@ const (
 	Failed
 	Terminated
 	Unknown
+	Cancelled
+	Restarting
+	Queued // waiting for the node or the cluster to run fewer supervisors
 )
 
 type Event uint8
@@ -32,6 +37,9 @@ const (
 	TearedDown           = 4
 	StartReport          = 5
 	EndReport            = 6
+	Cancel               = 7
+	Crashed              = 8
+	Queue                = 9
 )
 
 type SupervisorData struct {
@@ -49,12 +57,183 @@ type Supervisor struct {
 	State     Status              `json:"status"`
 	mode      cluster.OnCrash     `json:"on-crash"`
 	StartTime time.Time           `json:"start-time"`
+	Attempt   int                 `json:"attempt"`
+	Panics    []WorkerPanic       `json:"panics"`
 
-	etChannel *channel.ManagedChannel
-	tlChannel *channel.ManagedChannel
+	Parameters cluster.Parameters `json:"parameters,omitempty"` // the runtime parameters the supervisor was provisioned with
+	Outputs    map[string]any     `json:"outputs,omitempty"`    // recorded by the stages through their run
+
+	cluster string         // the identifier the cluster was registered under
+	logger  cluster.Logger // handed to the stages through their run, nil logs to the standard logger
+	cache   cluster.Cache
+
+	ctx     context.Context // spans every attempt, cancelled by Stop
+	cancel  context.CancelFunc
+	current *attempt
+
+	deadLetters *deadletter.Store // shared by every supervisor of the cluster, nil if rejected data units are dropped
+
+	mutex sync.RWMutex
+}
+
+type WorkerPanic struct {
+	Attempt   int             `json:"attempt"`
+	Stage     string          `json:"stage"`
+	Segment   cluster.Segment `json:"segment"`
+	Value     string          `json:"value"`
+	Stack     string          `json:"stack"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// rejecter is the error output given to a transform or load stage
+type rejecter struct {
+	supervisor *Supervisor
+	stage      *stage
+}
+
+// retrier is the Retrier given to every stage
+type retrier struct {
+	supervisor *Supervisor
+	stage      *stage
+	policy     cluster.RetryPolicy
+}
+
+// recorder records the custom metrics and outputs of the stages in the supervisor
+type recorder struct {
+	supervisor *Supervisor
+}
+
+// attempt holds everything shared by the goroutines provisioned during a single attempt at running the cluster
+type attempt struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	stages   []*stage
+	channels []*channel.ManagedChannel // every channel of the attempt, including the branches
+
+	head     *channel.ManagedChannel     // the channel the extract stages push to
+	tail     *channel.ManagedChannel     // the channel the load stages are fed from
+	branches []*channel.ManagedChannel   // the outputs of the extract stages when several are merged into the head
+	router   func(channel.Message) []int // routes the tail to the load stages when there are several
+	sequence *sequencer                  // puts the data units back in order before the tail, nil unless the config is ordered
+
+	failed       chan struct{} // closed when a worker panic should fail the attempt
+	failOnce     sync.Once
+	replacements int
 
 	waitGroup sync.WaitGroup
-	mutex     sync.RWMutex
+	mutex     sync.Mutex
+}
+
+// stage is a stage of the pipeline as it runs within an attempt, guarded by the mutex of the attempt
+type stage struct {
+	cluster.Stage
+	index int
+
+	input  *channel.ManagedChannel // nil for the extract stage
+	output *channel.ManagedChannel // nil for the load stage
+
+	active    int
+	retiring  int // goroutines told to stop that have not yet returned
+	finished  bool
+	receivers []*channel.Receiver // one per goroutine pulling from the input
+
+	partitions *partitioner // routes the input to the goroutines by key, nil unless the stage is partitioned
+}
+
+// partitioner
+// Routes the input of a partitioned stage to a partition per goroutine, a key is hashed to one
+// of the partitions in the table. The table only changes once every goroutine in it has finished
+// with the data units routed to it, so the data units of a key are never handled concurrently.
+type partitioner struct {
+	name  string // the stage, envelopes are timed by the partitions instead of the input
+	key   cluster.KeyFunc
+	input *channel.ManagedChannel
+
+	table   []*partition
+	joining []*partition  // partitions of new goroutines, added to the table at the next rebalance
+	changed chan struct{} // closed when the table should be rebalanced
+
+	closed     bool // the input is done, nothing more is routed
+	cancelled  chan struct{}
+	cancelOnce sync.Once
+	rebalances int
+
+	mutex sync.Mutex
+	idle  *sync.Cond // broadcast whenever a goroutine comes back for another data unit
+}
+
+// partition is the channel a single goroutine of a partitioned stage pulls from
+type partition struct {
+	channel  *channel.ManagedChannel
+	receiver *channel.Receiver // replaced when another goroutine adopts the partition
+
+	pushed   uint64 // data units routed to the partition
+	taken    uint64 // data units pulled by the goroutine
+	finished uint64 // data units the goroutine is done with, it is done with one once it pulls again
+
+	leaving  bool // the goroutine was retired, it is stopped once it has finished its data units
+	orphaned bool // the goroutine returned, the next goroutine provisioned takes over the partition
+}
+
+// sequencer
+// Numbers the data units pushed by the extract stages and puts the data units descending from
+// them back in that order before the tail. An extract stage is held back once it gets as many
+// sequence numbers ahead of the oldest one not yet released as the reorder buffer can hold.
+type sequencer struct {
+	input  *channel.ManagedChannel // the channel the last transform stage pushes to
+	output *channel.ManagedChannel // the tail
+	size   int
+
+	next     uint64                       // the sequence number handed to the next data unit
+	released uint64                       // every sequence number below has been released to the tail
+	pending  map[uint64][]channel.Message // groups that arrived before an earlier one
+	credits  chan struct{}                // one per sequence number handed out but not yet released
+	done     chan struct{}                // closed once nothing more is released to the tail
+
+	highWaterMark int
+	mutex         sync.Mutex
+}
+
+// sequenced is the group of data units descending from the data unit an extract stage pushed as seq
+type sequenced struct {
+	seq   uint64
+	items []channel.Message
+}
+
+// ordered
+// Wraps the channels of a single goroutine when the config is ordered. Everything the goroutine
+// pushes is grouped under the sequence number of the data unit it last pulled, and the group is
+// passed on once the goroutine comes back for another data unit.
+type ordered struct {
+	ctx       context.Context
+	sequencer *sequencer
+	input     channel.InputChannel
+	output    channel.OutputChannel
+
+	current *sequenced // the group being handed to the goroutine, nil if the data unit was not sequenced
+	index   int
+	outputs []channel.Message
+
+	mutex sync.Mutex
+}
+
+// member is the input of a single goroutine of a partitioned stage
+type member struct {
+	partitioner *partitioner
+	partition   *partition
+	receiver    *channel.Receiver
+}
+
+// holder
+// Wraps the input of a transform or load goroutine to remember the data unit it last pulled, so
+// the data unit a goroutine was working on when it panicked can be accounted for.
+type holder struct {
+	channel.InputChannel
+
+	held    channel.Message
+	holding bool
+	mutex   sync.Mutex
 }
 
 type SupervisorV2 struct {
@@ -0,0 +1,358 @@
+package trigger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+func NewWatcher() *Watcher {
+	watcher := new(Watcher)
+	watcher.entries = make(map[string]*entry)
+	return watcher
+}
+
+// Add validates the trigger and starts watching its directory
+func (watcher *Watcher) Add(trigger Trigger) (success bool, description string) {
+	e, description := newEntry(trigger)
+	if e == nil {
+		return false, description
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if _, found := watcher.entries[trigger.Name]; found {
+		return false, "a trigger with that name already exists"
+	}
+	watcher.entries[trigger.Name] = e
+
+	return true, ""
+}
+
+// newEntry returns nil and why if the trigger is not valid
+func newEntry(trigger Trigger) (*entry, string) {
+	if len(trigger.Name) == 0 {
+		return nil, "a trigger needs a name"
+	}
+	if len(trigger.Cluster) == 0 {
+		return nil, "a trigger needs a cluster to provision"
+	}
+	if len(trigger.Directory) == 0 {
+		return nil, "a trigger needs a directory to watch"
+	}
+
+	directory, err := filepath.Abs(trigger.Directory)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if info, err := os.Stat(directory); (err != nil) || !info.IsDir() {
+		return nil, fmt.Sprintf("%s is not a directory", trigger.Directory)
+	}
+	trigger.Directory = directory
+
+	if len(trigger.Pattern) == 0 {
+		trigger.Pattern = DefaultPattern
+	}
+	if _, err := filepath.Match(trigger.Pattern, ""); err != nil {
+		return nil, fmt.Sprintf("the pattern %s is not a valid glob", trigger.Pattern)
+	}
+	if len(trigger.Parameter) == 0 {
+		trigger.Parameter = DefaultParameter
+	}
+
+	e := new(entry)
+
+	e.debounce = DefaultDebounce
+	if len(trigger.Debounce) != 0 {
+		debounce, err := time.ParseDuration(trigger.Debounce)
+		if (err != nil) || (debounce < 0) {
+			return nil, "the debounce should be a duration such as 5s"
+		}
+		e.debounce = debounce
+	}
+
+	// archive directories are relative to the watched directory unless they are absolute
+	trigger.Processed = resolve(directory, trigger.Processed, DefaultProcessedDirectory)
+	trigger.Failed = resolve(directory, trigger.Failed, DefaultFailedDirectory)
+
+	e.status.Trigger = trigger
+	e.observations = make(map[string]observation)
+	e.flights = make(map[string]*flight)
+	e.hashes = make(map[string]bool)
+	e.order = make([]string, 0)
+
+	return e, ""
+}
+
+func resolve(directory, path, fallback string) string {
+	if len(path) == 0 {
+		path = fallback
+	}
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(directory, path)
+}
+
+// Remove stops watching the directory of the trigger, the runs it started are left to complete but their files are not archived
+func (watcher *Watcher) Remove(name string) bool {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if _, found := watcher.entries[name]; !found {
+		return false
+	}
+	delete(watcher.entries, name)
+	return true
+}
+
+func (watcher *Watcher) Get(name string) (Status, bool) {
+	watcher.mutex.RLock()
+	defer watcher.mutex.RUnlock()
+
+	if e, found := watcher.entries[name]; found {
+		return e.status, true
+	}
+	return Status{}, false
+}
+
+// List returns the status of every trigger ordered by name
+func (watcher *Watcher) List() []Status {
+	watcher.mutex.RLock()
+	defer watcher.mutex.RUnlock()
+
+	statuses := make([]Status, 0, len(watcher.entries))
+	for _, e := range watcher.entries {
+		statuses = append(statuses, e.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses
+}
+
+// Scan
+// Looks over the directory of every trigger and returns the files that have arrived at now. A file
+// has arrived once its size and modification time have been left unchanged for the debounce of the
+// trigger. A file whose content was seen before is moved to the processed directory instead. Every
+// arrival must be reported back using Provisioned.
+func (watcher *Watcher) Scan(now time.Time) []Arrival {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	arrivals := make([]Arrival, 0)
+	for _, e := range watcher.entries {
+		arrivals = append(arrivals, e.scan(now)...)
+	}
+
+	return arrivals
+}
+
+func (e *entry) scan(now time.Time) []Arrival {
+	files, err := os.ReadDir(e.status.Directory)
+	if err != nil {
+		e.status.LastError = err.Error()
+		return nil
+	}
+
+	arrivals := make([]Arrival, 0)
+	present := make(map[string]bool)
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		if matched, _ := filepath.Match(e.status.Pattern, file.Name()); !matched {
+			continue
+		}
+
+		path := filepath.Join(e.status.Directory, file.Name())
+		present[path] = true
+		if _, inFlight := e.flights[path]; inFlight {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue // the file was removed since the directory was read
+		}
+
+		// a file that is still being written keeps changing, the debounce starts over every time it does
+		o, found := e.observations[path]
+		if !found || (o.size != info.Size()) || !o.modTime.Equal(info.ModTime()) {
+			o = observation{size: info.Size(), modTime: info.ModTime(), since: now}
+			e.observations[path] = o
+		}
+		if now.Sub(o.since) < e.debounce {
+			continue
+		}
+		delete(e.observations, path)
+
+		hash, err := hashFile(path)
+		if err != nil {
+			e.status.LastError = err.Error()
+			continue
+		}
+
+		e.status.LastFile = path
+		e.status.LastArrival = now
+
+		if e.hashes[hash] {
+			e.status.NumDuplicates++
+			if err := archive(path, e.status.Processed, now); err != nil {
+				e.status.LastError = err.Error()
+			}
+			continue
+		}
+		e.remember(hash)
+
+		e.flights[path] = &flight{hash: hash}
+		arrivals = append(arrivals, Arrival{Trigger: e.status.Trigger, Path: path, Hash: hash})
+	}
+	e.status.InFlight = len(e.flights)
+
+	// files removed before they arrived are no longer observed
+	for path := range e.observations {
+		if !present[path] {
+			delete(e.observations, path)
+		}
+	}
+
+	return arrivals
+}
+
+// Provisioned records the supervisor the file was provisioned as, or why the cluster could not be provisioned
+func (watcher *Watcher) Provisioned(name, path string, supervisor uint64, success bool, description string) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	e, found := watcher.entries[name]
+	if !found {
+		return // the trigger was removed while the cluster was being provisioned
+	}
+	f, found := e.flights[path]
+	if !found {
+		return
+	}
+
+	if success {
+		f.supervisor = supervisor
+		e.status.LastSupervisor = supervisor
+		e.status.NumProvisioned++
+	} else {
+		e.fail(path, description, time.Now())
+	}
+}
+
+// Flights returns the files whose cluster was provisioned and whose run has not been reported to complete
+func (watcher *Watcher) Flights() []Flight {
+	watcher.mutex.RLock()
+	defer watcher.mutex.RUnlock()
+
+	flights := make([]Flight, 0)
+	for _, e := range watcher.entries {
+		for path, f := range e.flights {
+			if f.supervisor != 0 {
+				flights = append(flights, Flight{Trigger: e.status.Name, Cluster: e.status.Cluster, Path: path, Supervisor: f.supervisor})
+			}
+		}
+	}
+
+	return flights
+}
+
+// Completed archives the file once its run completes, to the processed directory if it succeeded and the failed directory otherwise
+func (watcher *Watcher) Completed(name, path string, success bool, description string) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	e, found := watcher.entries[name]
+	if !found {
+		return
+	}
+	if _, found := e.flights[path]; !found {
+		return
+	}
+
+	if !success {
+		e.fail(path, description, time.Now())
+		return
+	}
+
+	e.status.NumSucceeded++
+	if err := archive(path, e.status.Processed, time.Now()); err != nil {
+		e.status.LastError = err.Error()
+	}
+	delete(e.flights, path)
+	e.status.InFlight = len(e.flights)
+}
+
+// fail moves the file to the failed directory, its content is forgotten so the file can be dropped in again to retry
+func (e *entry) fail(path, description string, now time.Time) {
+	e.status.NumFailed++
+	e.status.LastError = description
+
+	if f, found := e.flights[path]; found {
+		e.forget(f.hash)
+	}
+	if err := archive(path, e.status.Failed, now); err != nil {
+		e.status.LastError = err.Error()
+	}
+	delete(e.flights, path)
+	e.status.InFlight = len(e.flights)
+}
+
+func (e *entry) remember(hash string) {
+	e.hashes[hash] = true
+	e.order = append(e.order, hash)
+
+	if len(e.order) > MaxRememberedHashes {
+		delete(e.hashes, e.order[0])
+		e.order = e.order[1:]
+	}
+}
+
+func (e *entry) forget(hash string) {
+	delete(e.hashes, hash)
+	for i, remembered := range e.order {
+		if remembered == hash {
+			e.order = append(e.order[:i], e.order[i+1:]...)
+			break
+		}
+	}
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// archive moves the file into the directory, a file of the same name already there is kept by suffixing the time of the move
+func archive(path, directory string, now time.Time) error {
+	if err := os.MkdirAll(directory, 0755); err != nil {
+		return err
+	}
+
+	name := filepath.Base(path)
+	target := filepath.Join(directory, name)
+	if _, err := os.Stat(target); err == nil {
+		extension := filepath.Ext(name)
+		target = filepath.Join(directory, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, extension), now.UnixNano(), extension))
+	}
+
+	return os.Rename(path, target)
+}
@@ -0,0 +1,107 @@
+package trigger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcherScan(t *testing.T) {
+	directory := t.TempDir()
+	start := time.Now()
+
+	watcher := NewWatcher()
+	if success, description := watcher.Add(Trigger{Name: "orders", Cluster: "load", Directory: directory, Pattern: "*.csv", Debounce: "5s"}); !success {
+		t.Fatal(description)
+	}
+
+	write := func(name, content string) string {
+		path := filepath.Join(directory, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	first := write("first.csv", "a,b,c")
+	write("ignored.txt", "a,b,c")
+
+	// the file is only picked up once it has been left unchanged for the debounce
+	if arrivals := watcher.Scan(start); len(arrivals) != 0 {
+		t.Fatalf("expected the debounce to hold the file back, got %v", arrivals)
+	}
+	arrivals := watcher.Scan(start.Add(5 * time.Second))
+	if (len(arrivals) != 1) || (arrivals[0].Path != first) || (arrivals[0].Parameter != DefaultParameter) {
+		t.Fatalf("expected the csv to arrive, got %v", arrivals)
+	}
+	if arrivals := watcher.Scan(start.Add(10 * time.Second)); len(arrivals) != 0 {
+		t.Fatalf("expected the file in flight to be left alone, got %v", arrivals)
+	}
+
+	watcher.Provisioned("orders", first, 1, true, "")
+	if flights := watcher.Flights(); (len(flights) != 1) || (flights[0].Supervisor != 1) {
+		t.Fatalf("expected the file to be in flight, got %v", flights)
+	}
+	watcher.Completed("orders", first, true, "")
+	if exists(first) || !exists(filepath.Join(directory, DefaultProcessedDirectory, "first.csv")) {
+		t.Error("expected the file to be moved to the processed directory")
+	}
+
+	// the same content under another name is a duplicate, and is archived without a run
+	duplicate := write("second.csv", "a,b,c")
+	watcher.Scan(start.Add(15 * time.Second))
+	if arrivals := watcher.Scan(start.Add(20 * time.Second)); len(arrivals) != 0 {
+		t.Fatalf("expected the duplicate to be skipped, got %v", arrivals)
+	}
+	if status, _ := watcher.Get("orders"); (status.NumDuplicates != 1) || exists(duplicate) {
+		t.Errorf("expected the duplicate to be archived, got %d duplicates", status.NumDuplicates)
+	}
+
+	// a failed run archives the file to the failed directory and forgets its content so it can be retried
+	failed := write("third.csv", "d,e,f")
+	watcher.Scan(start.Add(25 * time.Second))
+	watcher.Scan(start.Add(30 * time.Second))
+	watcher.Provisioned("orders", failed, 0, false, "cluster not mounted")
+	if exists(failed) || !exists(filepath.Join(directory, DefaultFailedDirectory, "third.csv")) {
+		t.Error("expected the file to be moved to the failed directory")
+	}
+
+	retried := write("third.csv", "d,e,f")
+	watcher.Scan(start.Add(35 * time.Second))
+	if arrivals := watcher.Scan(start.Add(40 * time.Second)); (len(arrivals) != 1) || (arrivals[0].Path != retried) {
+		t.Fatalf("expected the retried file to arrive, got %v", arrivals)
+	}
+
+	status, _ := watcher.Get("orders")
+	if (status.NumSucceeded != 1) || (status.NumFailed != 1) || (status.InFlight != 1) || (status.LastError != "cluster not mounted") {
+		t.Errorf("unexpected status %+v", status)
+	}
+}
+
+func TestWatcherAdd(t *testing.T) {
+	directory := t.TempDir()
+
+	watcher := NewWatcher()
+	for _, trigger := range []Trigger{
+		{Name: "missing", Cluster: "load", Directory: filepath.Join(directory, "missing")},
+		{Name: "pattern", Cluster: "load", Directory: directory, Pattern: "[a-"},
+		{Name: "debounce", Cluster: "load", Directory: directory, Debounce: "soon"},
+		{Name: "cluster", Directory: directory},
+	} {
+		if success, _ := watcher.Add(trigger); success {
+			t.Errorf("expected %s to be rejected", trigger.Name)
+		}
+	}
+
+	if success, description := watcher.Add(Trigger{Name: "archive", Cluster: "load", Directory: directory, Failed: "/tmp/rejected"}); !success {
+		t.Fatal(description)
+	}
+	if status, _ := watcher.Get("archive"); (status.Processed != filepath.Join(directory, "processed")) || (status.Failed != "/tmp/rejected") {
+		t.Errorf("expected the archive directories to be resolved, got %s and %s", status.Processed, status.Failed)
+	}
+}
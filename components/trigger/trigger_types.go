@@ -0,0 +1,88 @@
+package trigger
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultDebounce           = 2 * time.Second // a file has to be left unchanged this long before it is picked up
+	DefaultParameter          = "path"
+	DefaultPattern            = "*"
+	DefaultProcessedDirectory = "processed" // relative to the watched directory
+	DefaultFailedDirectory    = "failed"
+	MaxRememberedHashes       = 10000 // hashes kept for de-duplication by every trigger, the oldest are forgotten first
+)
+
+// Trigger provisions a cluster for every file that lands in a directory and matches a glob pattern
+type Trigger struct {
+	Name       string             `json:"name"`
+	Cluster    string             `json:"cluster"`
+	Config     string             `json:"config,omitempty"` // the config the cluster is provisioned with, the cluster identifier if empty
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+	Directory  string             `json:"directory"`
+	Pattern    string             `json:"pattern,omitempty"`   // matched against the name of every file in the directory, * if empty
+	Parameter  string             `json:"parameter,omitempty"` // the parameter given the path of the file, path if empty
+	Debounce   string             `json:"debounce,omitempty"`  // a duration such as 5s, 2s if empty
+	Processed  string             `json:"processed,omitempty"` // where a file is moved once its run succeeds, processed within the directory if empty
+	Failed     string             `json:"failed,omitempty"`    // where a file is moved if its run fails, failed within the directory if empty
+	Priority   int                `json:"priority,omitempty"`  // queued supervisors with a higher priority are admitted first
+}
+
+// Status is a trigger along with what happened to the files it picked up
+type Status struct {
+	Trigger
+	LastFile       string    `json:"last-file,omitempty"`
+	LastArrival    time.Time `json:"last-arrival"`
+	LastSupervisor uint64    `json:"last-supervisor,omitempty"`
+	LastError      string    `json:"last-error,omitempty"`
+	NumProvisioned int       `json:"num-provisioned"`
+	NumSucceeded   int       `json:"num-succeeded"`
+	NumFailed      int       `json:"num-failed"`
+	NumDuplicates  int       `json:"num-duplicates"` // files moved to the processed directory without a run, their content was seen before
+	InFlight       int       `json:"in-flight"`
+}
+
+// Arrival is a file that should be provisioned
+type Arrival struct {
+	Trigger
+	Path string
+	Hash string
+}
+
+// Flight is a file whose run has not yet been seen to complete
+type Flight struct {
+	Trigger    string
+	Cluster    string
+	Path       string
+	Supervisor uint64
+}
+
+// observation is the last size and modification time seen of a file, and since when they have not changed
+type observation struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+type flight struct {
+	hash       string
+	supervisor uint64 // zero until the cluster is provisioned
+}
+
+type entry struct {
+	status   Status
+	debounce time.Duration
+
+	observations map[string]observation
+	flights      map[string]*flight // files picked up and not yet archived, by path
+
+	hashes map[string]bool
+	order  []string // the hashes in the order they were seen
+}
+
+type Watcher struct {
+	entries map[string]*entry
+	mutex   sync.RWMutex
+}
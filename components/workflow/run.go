@@ -0,0 +1,183 @@
+package workflow
+
+import (
+	"fmt"
+	"github.com/GabeCordo/etl/components/cluster"
+	"time"
+)
+
+func (run *Run) Id() uint64 {
+	return run.status.Id
+}
+
+// Ready
+// Returns the nodes that can be provisioned now and marks them as running. A node whose edges can
+// no longer all be satisfied is skipped, and a node missing an output it maps to a parameter fails,
+// without either being handed out. A node is ready once every node upstream of it has ended.
+func (run *Run) Ready() []Task {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	tasks := make([]Task, 0)
+	// skipping or failing a node can decide the nodes downstream of it, so the nodes are looked over until nothing changes
+	for changed := true; changed; {
+		changed = false
+
+		for i, node := range run.workflow.Nodes {
+			status := &run.status.Nodes[i]
+			if status.State != Pending {
+				continue
+			}
+
+			waiting, reason := run.evaluate(node)
+			if waiting {
+				continue
+			}
+			changed = true
+
+			if len(reason) != 0 {
+				status.State = Skipped
+				status.Error = reason
+				status.EndTime = time.Now()
+				continue
+			}
+
+			parameters, missing := run.parameters(node)
+			if len(missing) != 0 {
+				status.State = Failed
+				status.Error = missing
+				status.EndTime = time.Now()
+				continue
+			}
+
+			status.State = Running
+			status.Parameters = parameters
+			status.StartTime = time.Now()
+			tasks = append(tasks, Task{Node: node.Name, Cluster: node.Cluster, Config: node.Config, Parameters: parameters})
+		}
+	}
+
+	run.complete()
+	return tasks
+}
+
+// evaluate returns true if the node has to wait on an upstream node, otherwise why the node is skipped if it should be
+func (run *Run) evaluate(node Node) (waiting bool, reason string) {
+	for _, edge := range node.After {
+		upstream := run.status.Nodes[run.index[edge.Node]].State
+
+		var satisfied bool
+		switch upstream {
+		case Pending, Running:
+			waiting = true
+			continue
+		case Succeeded:
+			satisfied = (edge.When == "") || (edge.When == OnSuccess) || (edge.When == OnComplete)
+		case Failed:
+			satisfied = (edge.When == OnFailure) || (edge.When == OnComplete)
+		case Skipped:
+			satisfied = edge.When == OnComplete
+		}
+
+		// the node is skipped as soon as one edge cannot be satisfied, there is no need to wait on the others
+		if !satisfied {
+			return false, fmt.Sprintf("upstream node %s %s", edge.Node, upstream)
+		}
+	}
+	return waiting, ""
+}
+
+// parameters returns what the node is provisioned with, or which output of an upstream node is missing
+func (run *Run) parameters(node Node) (parameters cluster.Parameters, missing string) {
+	parameters = make(cluster.Parameters)
+	for name, value := range run.status.Parameters {
+		parameters[name] = value
+	}
+	for name, value := range node.Parameters {
+		parameters[name] = value
+	}
+
+	for _, edge := range node.After {
+		outputs := run.status.Nodes[run.index[edge.Node]].Outputs
+		for parameter, output := range edge.Outputs {
+			value, found := outputs[output]
+			if !found {
+				return nil, fmt.Sprintf("upstream node %s did not record the output %s", edge.Node, output)
+			}
+			parameters[parameter] = value
+		}
+	}
+
+	return parameters, ""
+}
+
+// Started records the supervisor the node was provisioned as
+func (run *Run) Started(node string, supervisor uint64) {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	if i, found := run.index[node]; found {
+		run.status.Nodes[i].Supervisor = supervisor
+	}
+}
+
+// Finished records how the node ended along with the outputs its run recorded
+func (run *Run) Finished(node string, success bool, description string, outputs map[string]any) {
+	run.mutex.Lock()
+	defer run.mutex.Unlock()
+
+	i, found := run.index[node]
+	if !found {
+		return
+	}
+
+	status := &run.status.Nodes[i]
+	if success {
+		status.State = Succeeded
+	} else {
+		status.State = Failed
+		status.Error = description
+	}
+	status.Outputs = outputs
+	status.EndTime = time.Now()
+
+	run.complete()
+}
+
+// complete ends the run once every node has ended, the run fails if any node failed, the mutex must be held
+func (run *Run) complete() {
+	state := Succeeded
+	for _, node := range run.status.Nodes {
+		switch node.State {
+		case Pending, Running:
+			return
+		case Failed:
+			state = Failed
+		}
+	}
+
+	if run.status.EndTime.IsZero() {
+		run.status.State = state
+		run.status.EndTime = time.Now()
+	}
+}
+
+// Done returns true once every node of the run has ended
+func (run *Run) Done() bool {
+	run.mutex.RLock()
+	defer run.mutex.RUnlock()
+
+	return !run.status.EndTime.IsZero()
+}
+
+// Status returns a copy of the status of the run and its nodes
+func (run *Run) Status() Status {
+	run.mutex.RLock()
+	defer run.mutex.RUnlock()
+
+	status := run.status
+	status.Nodes = make([]NodeStatus, len(run.status.Nodes))
+	copy(status.Nodes, run.status.Nodes)
+
+	return status
+}
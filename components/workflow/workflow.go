@@ -0,0 +1,219 @@
+package workflow
+
+import (
+	"fmt"
+	"github.com/GabeCordo/etl/components/cluster"
+	"sort"
+	"time"
+)
+
+func NewStore() *Store {
+	store := new(Store)
+	store.workflows = make(map[string]Workflow)
+	store.runs = make(map[uint64]*Run)
+	return store
+}
+
+// Validate checks that every edge of the workflow is between two of its nodes and that the edges do not form a cycle
+func Validate(workflow Workflow) (success bool, description string) {
+	if len(workflow.Name) == 0 {
+		return false, "a workflow needs a name"
+	}
+	if len(workflow.Nodes) == 0 {
+		return false, "a workflow needs at least one node"
+	}
+
+	nodes := make(map[string]bool)
+	for _, node := range workflow.Nodes {
+		if len(node.Name) == 0 {
+			return false, "every node needs a name"
+		}
+		if len(node.Cluster) == 0 {
+			return false, fmt.Sprintf("node %s needs a cluster to provision", node.Name)
+		}
+		if nodes[node.Name] {
+			return false, fmt.Sprintf("there is more than one node named %s", node.Name)
+		}
+		nodes[node.Name] = true
+	}
+
+	dependents := make(map[string][]string)
+	remaining := make(map[string]int) // edges into every node that have not been visited
+	for _, node := range workflow.Nodes {
+		upstream := make(map[string]bool)
+		for _, edge := range node.After {
+			if !nodes[edge.Node] {
+				return false, fmt.Sprintf("node %s is after %s, which is not a node of the workflow", node.Name, edge.Node)
+			}
+			if (edge.Node == node.Name) || upstream[edge.Node] {
+				return false, fmt.Sprintf("node %s has more than one edge from %s", node.Name, edge.Node)
+			}
+			switch edge.When {
+			case "", OnSuccess, OnFailure, OnComplete:
+			default:
+				return false, fmt.Sprintf("unknown condition %s on the edge from %s to %s", edge.When, edge.Node, node.Name)
+			}
+			upstream[edge.Node] = true
+			dependents[edge.Node] = append(dependents[edge.Node], node.Name)
+		}
+		remaining[node.Name] = len(node.After)
+	}
+
+	// every node is visited once the nodes upstream of it are, any left unvisited are part of a cycle
+	queue := make([]string, 0, len(workflow.Nodes))
+	for _, node := range workflow.Nodes {
+		if remaining[node.Name] == 0 {
+			queue = append(queue, node.Name)
+		}
+	}
+	visited := 0
+	for ; len(queue) > 0; queue = queue[1:] {
+		visited++
+		for _, dependent := range dependents[queue[0]] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	if visited != len(workflow.Nodes) {
+		return false, "the edges of the workflow form a cycle"
+	}
+
+	return true, ""
+}
+
+// Define validates the workflow and adds it to the store
+func (store *Store) Define(workflow Workflow) (success bool, description string) {
+	if success, description = Validate(workflow); !success {
+		return false, description
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, found := store.workflows[workflow.Name]; found {
+		return false, "a workflow with that name already exists"
+	}
+	store.workflows[workflow.Name] = workflow
+
+	return true, ""
+}
+
+// Remove deletes the workflow, runs already started are left to end
+func (store *Store) Remove(name string) bool {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if _, found := store.workflows[name]; !found {
+		return false
+	}
+	delete(store.workflows, name)
+	return true
+}
+
+func (store *Store) Get(name string) (Workflow, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	workflow, found := store.workflows[name]
+	return workflow, found
+}
+
+// List returns every workflow ordered by name
+func (store *Store) List() []Workflow {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	workflows := make([]Workflow, 0, len(store.workflows))
+	for _, workflow := range store.workflows {
+		workflows = append(workflows, workflow)
+	}
+	sort.Slice(workflows, func(i, j int) bool { return workflows[i].Name < workflows[j].Name })
+
+	return workflows
+}
+
+// Start creates a run of the workflow, the parameters are given to every node of the run
+func (store *Store) Start(name string, parameters cluster.Parameters) (run *Run, success bool, description string) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	workflow, found := store.workflows[name]
+	if !found {
+		return nil, false, "workflow not found"
+	}
+
+	store.counter++
+	run = newRun(store.counter, workflow, parameters)
+	store.runs[run.status.Id] = run
+	store.prune(name)
+
+	return run, true, ""
+}
+
+// prune drops the oldest finished runs of the workflow once it has more than MaxRunsPerWorkflow, the mutex must be held
+func (store *Store) prune(name string) {
+	finished := make([]uint64, 0)
+	for id, run := range store.runs {
+		if status := run.Status(); (status.Workflow == name) && !status.EndTime.IsZero() {
+			finished = append(finished, id)
+		}
+	}
+	if len(finished) <= MaxRunsPerWorkflow {
+		return
+	}
+
+	sort.Slice(finished, func(i, j int) bool { return finished[i] < finished[j] })
+	for _, id := range finished[:len(finished)-MaxRunsPerWorkflow] {
+		delete(store.runs, id)
+	}
+}
+
+// Run returns the status of the run
+func (store *Store) Run(id uint64) (Status, bool) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	if run, found := store.runs[id]; found {
+		return run.Status(), true
+	}
+	return Status{}, false
+}
+
+// Runs returns the status of every run of the workflow, or of every workflow if the name is empty, newest first
+func (store *Store) Runs(name string) []Status {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	statuses := make([]Status, 0)
+	for _, run := range store.runs {
+		if status := run.Status(); (len(name) == 0) || (status.Workflow == name) {
+			statuses = append(statuses, status)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Id > statuses[j].Id })
+
+	return statuses
+}
+
+func newRun(id uint64, workflow Workflow, parameters cluster.Parameters) *Run {
+	run := new(Run)
+
+	run.workflow = workflow
+	run.index = make(map[string]int)
+	run.status = Status{
+		Id:         id,
+		Workflow:   workflow.Name,
+		State:      Running,
+		Parameters: parameters,
+		Nodes:      make([]NodeStatus, len(workflow.Nodes)),
+		StartTime:  time.Now(),
+	}
+	for i, node := range workflow.Nodes {
+		run.index[node.Name] = i
+		run.status.Nodes[i] = NodeStatus{Name: node.Name, Cluster: node.Cluster, State: Pending}
+	}
+
+	return run
+}
@@ -0,0 +1,119 @@
+package workflow
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		workflow Workflow
+		valid    bool
+	}{
+		{Workflow{Name: "nightly", Nodes: []Node{
+			{Name: "extract", Cluster: "a"},
+			{Name: "left", Cluster: "b", After: []Edge{{Node: "extract"}}},
+			{Name: "right", Cluster: "b", After: []Edge{{Node: "extract"}}},
+			{Name: "join", Cluster: "c", After: []Edge{{Node: "left"}, {Node: "right", When: OnComplete}}},
+		}}, true},
+		{Workflow{Name: "cycle", Nodes: []Node{
+			{Name: "a", Cluster: "a", After: []Edge{{Node: "c"}}},
+			{Name: "b", Cluster: "a", After: []Edge{{Node: "a"}}},
+			{Name: "c", Cluster: "a", After: []Edge{{Node: "b"}}},
+		}}, false},
+		{Workflow{Name: "self", Nodes: []Node{{Name: "a", Cluster: "a", After: []Edge{{Node: "a"}}}}}, false},
+		{Workflow{Name: "unknown", Nodes: []Node{{Name: "a", Cluster: "a", After: []Edge{{Node: "b"}}}}}, false},
+		{Workflow{Name: "duplicate", Nodes: []Node{{Name: "a", Cluster: "a"}, {Name: "a", Cluster: "b"}}}, false},
+		{Workflow{Name: "condition", Nodes: []Node{{Name: "a", Cluster: "a"}, {Name: "b", Cluster: "a", After: []Edge{{Node: "a", When: "always"}}}}}, false},
+	}
+
+	for _, c := range cases {
+		if valid, description := Validate(c.workflow); valid != c.valid {
+			t.Errorf("%s: expected valid to be %t (%s)", c.workflow.Name, c.valid, description)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	store := NewStore()
+	success, description := store.Define(Workflow{Name: "nightly", Nodes: []Node{
+		{Name: "extract", Cluster: "extract"},
+		{Name: "orders", Cluster: "load", Parameters: cluster.Parameters{"table": "orders"}, After: []Edge{
+			{Node: "extract", Outputs: map[string]string{"input": "cache-id"}},
+		}},
+		{Name: "customers", Cluster: "load", After: []Edge{{Node: "extract"}}},
+		{Name: "report", Cluster: "report", After: []Edge{{Node: "orders"}, {Node: "customers"}}},
+		{Name: "cleanup", Cluster: "cleanup", After: []Edge{{Node: "report", When: OnComplete}}},
+		{Name: "alert", Cluster: "alert", After: []Edge{{Node: "customers", When: OnFailure}}},
+	}})
+	if !success {
+		t.Fatal(description)
+	}
+
+	run, success, description := store.Start("nightly", cluster.Parameters{"date": "2024-01-01"})
+	if !success {
+		t.Fatal(description)
+	}
+
+	expectReady := func(expected ...string) []Task {
+		tasks := run.Ready()
+		if len(tasks) != len(expected) {
+			t.Fatalf("expected %v to be ready, got %v", expected, tasks)
+		}
+		for i, task := range tasks {
+			if task.Node != expected[i] {
+				t.Fatalf("expected %v to be ready, got %v", expected, tasks)
+			}
+		}
+		return tasks
+	}
+
+	expectReady("extract")
+	expectReady()
+	run.Finished("extract", true, "", map[string]any{"cache-id": "abc"})
+
+	// the outputs of the upstream node are passed on alongside the parameters of the run and node
+	tasks := expectReady("orders", "customers")
+	if (tasks[0].Parameters["input"] != "abc") || (tasks[0].Parameters["table"] != "orders") || (tasks[0].Parameters["date"] != "2024-01-01") {
+		t.Errorf("unexpected parameters %v", tasks[0].Parameters)
+	}
+
+	// the fan-in waits on both upstream nodes, a failure skips it but not the nodes after it on a complete edge
+	run.Finished("orders", true, "", nil)
+	expectReady()
+	run.Finished("customers", false, "crashed", nil)
+	expectReady("cleanup", "alert")
+	if run.Done() {
+		t.Fatal("expected the run to wait on the running nodes")
+	}
+	run.Finished("cleanup", true, "", nil)
+	run.Finished("alert", true, "", nil)
+
+	status, found := store.Run(run.Id())
+	if !found {
+		t.Fatal("expected the run to be in the store")
+	}
+	if !run.Done() || (status.State != Failed) {
+		t.Errorf("expected the run to have failed, got %s", status.State)
+	}
+	if report := status.Nodes[3]; (report.State != Skipped) || (report.Error != "upstream node customers failed") {
+		t.Errorf("expected the report to be skipped, got %s (%s)", report.State, report.Error)
+	}
+}
+
+func TestRunMissingOutput(t *testing.T) {
+	run := newRun(1, Workflow{Name: "outputs", Nodes: []Node{
+		{Name: "extract", Cluster: "extract"},
+		{Name: "load", Cluster: "load", After: []Edge{{Node: "extract", Outputs: map[string]string{"input": "cache-id"}}}},
+	}}, nil)
+
+	run.Ready()
+	run.Finished("extract", true, "", nil)
+
+	if tasks := run.Ready(); len(tasks) != 0 {
+		t.Fatalf("expected nothing to be ready, got %v", tasks)
+	}
+	if status := run.Status(); (status.State != Failed) || (status.Nodes[1].State != Failed) {
+		t.Errorf("expected the load to fail without the output, got %s", status.Nodes[1].State)
+	}
+}
@@ -0,0 +1,102 @@
+package workflow
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"sync"
+	"time"
+)
+
+const (
+	MaxRunsPerWorkflow = 50 // finished runs kept for every workflow, the oldest are dropped first
+)
+
+// Condition is what the upstream node of an edge has to end in for the downstream node to run
+type Condition string
+
+const (
+	OnSuccess  Condition = "success"  // the upstream node succeeded
+	OnFailure  Condition = "failure"  // the upstream node failed, such as for a node that cleans up or raises an alert
+	OnComplete Condition = "complete" // the upstream node ended, whatever it ended in
+)
+
+// State is where a node, or the workflow run as a whole, is at
+type State string
+
+const (
+	Pending   State = "pending"
+	Running   State = "running"
+	Succeeded State = "succeeded"
+	Failed    State = "failed"
+	Skipped   State = "skipped" // an edge into the node was not satisfied, the cluster was never provisioned
+)
+
+// Workflow is a DAG of cluster provisions, a node is provisioned once the nodes upstream of it have ended
+type Workflow struct {
+	Name  string `json:"name"`
+	Nodes []Node `json:"nodes"`
+}
+
+type Node struct {
+	Name       string             `json:"name"`
+	Cluster    string             `json:"cluster"`
+	Config     string             `json:"config,omitempty"` // the config the cluster is provisioned with, the cluster identifier if empty
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+	After      []Edge             `json:"after,omitempty"` // a node without any edges is provisioned as soon as the workflow starts
+}
+
+// Edge
+// Makes a node wait on an upstream node. The outputs name the parameters of the downstream node
+// that are given the outputs the upstream run recorded, such as the identifier of data it saved
+// to the cache.
+type Edge struct {
+	Node    string            `json:"node"`
+	When    Condition         `json:"when,omitempty"`    // success if empty
+	Outputs map[string]string `json:"outputs,omitempty"` // parameter of the downstream node -> output of the upstream node
+}
+
+type NodeStatus struct {
+	Name       string             `json:"name"`
+	Cluster    string             `json:"cluster"`
+	State      State              `json:"state"`
+	Supervisor uint64             `json:"supervisor,omitempty"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"` // what the cluster was provisioned with
+	Outputs    map[string]any     `json:"outputs,omitempty"`
+	Error      string             `json:"error,omitempty"`
+	StartTime  time.Time          `json:"start-time"`
+	EndTime    time.Time          `json:"end-time"`
+}
+
+// Status is a run of a workflow along with the status of every node in it
+type Status struct {
+	Id         uint64             `json:"id"`
+	Workflow   string             `json:"workflow"`
+	State      State              `json:"state"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"` // given to every node, the parameters of a node take precedence
+	Nodes      []NodeStatus       `json:"nodes"`
+	StartTime  time.Time          `json:"start-time"`
+	EndTime    time.Time          `json:"end-time"`
+}
+
+// Task is a node that is ready to be provisioned
+type Task struct {
+	Node       string
+	Cluster    string
+	Config     string
+	Parameters cluster.Parameters
+}
+
+type Run struct {
+	status   Status
+	workflow Workflow
+	index    map[string]int // the position of every node in the workflow and status
+
+	mutex sync.RWMutex
+}
+
+type Store struct {
+	workflows map[string]Workflow
+	runs      map[uint64]*Run
+	counter   uint64
+
+	mutex sync.RWMutex
+}
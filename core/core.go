@@ -11,10 +11,15 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 )
 
 const (
-	Version string = "v0.1.9-alpha"
+	Version string = "v0.2.0-alpha"
+
+	// DefaultTerminateWait is how long (in seconds) the node waits for supervisors to
+	// report back after they have been forcefully terminated
+	DefaultTerminateWait = 30
 )
 
 var (
@@ -96,6 +101,10 @@ func NewCore() *Core {
 	core.C9 = make(chan CacheRequest)
 	core.C10 = make(chan CacheResponse)
 	core.C11 = make(chan MessengerRequest)
+	core.C12 = make(chan ProvisionerRequest)
+	core.C13 = make(chan ProvisionerResponse)
+	core.C14 = make(chan ProvisionerRequest)
+	core.C15 = make(chan ProvisionerResponse)
 	core.interrupt = make(chan InterruptEvent)
 
 	var ok bool
@@ -103,7 +112,7 @@ func NewCore() *Core {
 	if !ok {
 		return nil
 	}
-	core.ProvisionerThread, ok = NewProvisioner(core.interrupt, core.C5, core.C6, core.C7, core.C8, core.C9, core.C10, core.C11)
+	core.ProvisionerThread, ok = NewProvisioner(core.interrupt, core.C5, core.C6, core.C7, core.C8, core.C9, core.C10, core.C11, core.C12, core.C13, core.C14, core.C15)
 	if !ok {
 		return nil
 	}
@@ -119,6 +128,14 @@ func NewCore() *Core {
 	if !ok {
 		return nil
 	}
+	core.SchedulerThread, ok = NewSchedulerThread(core.interrupt, core.C12, core.C13)
+	if !ok {
+		return nil
+	}
+	core.TriggerThread, ok = NewTriggerThread(core.interrupt, core.C14, core.C15)
+	if !ok {
+		return nil
+	}
 
 	return core
 }
@@ -163,6 +180,19 @@ func (core *Core) Run() {
 		log.Println(utils.Purple + "(+)" + utils.Reset + " Cache Thread Started")
 	}
 
+	// the schedules start firing once the provisioner can accept their requests
+	core.SchedulerThread.Setup()
+	go core.SchedulerThread.Start()
+	if GetConfigInstance().Debug {
+		log.Println(utils.Purple + "(+)" + utils.Reset + " Scheduler Thread Started")
+	}
+
+	core.TriggerThread.Setup()
+	go core.TriggerThread.Start()
+	if GetConfigInstance().Debug {
+		log.Println(utils.Purple + "(+)" + utils.Reset + " Trigger Thread Started")
+	}
+
 	// the gateway to the frontend cluster should be the last startup
 	core.HttpThread.Setup()
 	go core.HttpThread.Start() // event loop
@@ -193,14 +223,30 @@ func (core *Core) Run() {
 	// requiring us to cleanly close the application without risking the loss of Data
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	shuttingDown := make(chan struct{})
+	skipGracePeriod := make(chan struct{})
 	go func() {
-		<-sigs // block until we receive an interrupt from the system
-		core.interrupt <- Panic
+		select {
+		case <-sigs: // block until we receive an interrupt from the system
+			select {
+			case core.interrupt <- Panic:
+			case <-shuttingDown:
+			}
+		case <-shuttingDown:
+		}
+
+		// a second interrupt means the operator does not want to wait for the clusters to finish
+		<-sigs
+		close(skipGracePeriod)
 	}()
 
 	// an interrupt can be sent by any thread that has access to the channel if an
 	// error or end-state has been reached by the application
-	switch <-core.interrupt {
+	interrupt := <-core.interrupt
+	close(shuttingDown)
+
+	switch interrupt {
 	case Panic:
 		log.Println(utils.Red + "(IO)" + utils.Reset + " encountered panic")
 		break
@@ -216,8 +262,34 @@ func (core *Core) Run() {
 		log.Println(utils.Red + "(-)" + utils.Reset + " http shutdown")
 	}
 
+	// no more clusters should be provisioned on a schedule while the provisioner is shutting down
+	core.SchedulerThread.Teardown()
+
+	if GetConfigInstance().Debug {
+		log.Println(utils.Red + "(-)" + utils.Reset + " scheduler shutdown")
+	}
+
+	// nor for files that land in a watched directory
+	core.TriggerThread.Teardown()
+
+	if GetConfigInstance().Debug {
+		log.Println(utils.Red + "(-)" + utils.Reset + " trigger shutdown")
+	}
+
 	// THIS WILL TAKE THE LONGEST - clean channels and finish processing
-	core.ProvisionerThread.Teardown()
+	provisionerDone := make(chan struct{})
+	go func() {
+		core.ProvisionerThread.Teardown()
+		close(provisionerDone)
+	}()
+
+	hardTerminateTime := GetConfigInstance().HardTerminateTime
+	if hardTerminateTime <= 0 {
+		hardTerminateTime = DefaultHardTerminateTime
+	}
+
+	awaitTeardown(provisionerDone, skipGracePeriod, time.Duration(hardTerminateTime)*time.Minute,
+		core.ProvisionerThread.Terminate, DefaultTerminateWait*time.Second)
 
 	if GetConfigInstance().Debug {
 		log.Println(utils.Red + "(-)" + utils.Reset + " provisioner shutdown")
@@ -255,3 +327,28 @@ func (core *Core) Cluster(identifier string, cluster cluster.Cluster, config ...
 		d.StoreClusterConfig(config[0])
 	}
 }
+
+// awaitTeardown
+// Waits for the provisioner to tear down. The supervisors are terminated once the grace period
+// passes or the grace period is skipped by a second interrupt, and the supervisors that ignore
+// the termination are abandoned after the terminate wait so the node does not hang on them.
+func awaitTeardown(done, skip <-chan struct{}, grace time.Duration, terminate func(), terminateWait time.Duration) (terminated, abandoned bool) {
+	select {
+	case <-done:
+		return false, false
+	case <-time.After(grace):
+		log.Println(utils.Red + "(IO)" + utils.Reset + " hard-terminate-time reached, terminating clusters")
+	case <-skip:
+		log.Println(utils.Red + "(IO)" + utils.Reset + " received second interrupt, terminating clusters")
+	}
+
+	terminate()
+
+	select {
+	case <-done:
+		return true, false
+	case <-time.After(terminateWait):
+		log.Println(utils.Red + "(IO)" + utils.Reset + " abandoning clusters that did not respond to termination")
+		return true, true
+	}
+}
@@ -1,10 +1,17 @@
 package core
 
 import (
+	"fmt"
 	"github.com/GabeCordo/etl/components/cluster"
 	"github.com/GabeCordo/etl/components/database"
+	"github.com/GabeCordo/etl/components/deadletter"
+	"github.com/GabeCordo/etl/components/journal"
+	"github.com/GabeCordo/etl/components/provisioner"
+	"github.com/GabeCordo/etl/components/scheduler"
 	"github.com/GabeCordo/etl/components/supervisor"
+	"github.com/GabeCordo/etl/components/trigger"
 	"github.com/GabeCordo/etl/components/utils"
+	"github.com/GabeCordo/etl/components/workflow"
 	"log"
 	"math/rand"
 	"time"
@@ -182,11 +189,18 @@ func DynamicallyDeleteCluster(pipe chan<- ProvisionerRequest, responseTable *uti
 	return timeout || provisionerResponse.Success
 }
 
-func SupervisorProvision(pipe chan<- ProvisionerRequest, responseTable *utils.ResponseTable, cluster string, config ...string) (supervisorId uint64, success bool, description string) {
+func SupervisorProvision(pipe chan<- ProvisionerRequest, responseTable *utils.ResponseTable, clusterName, config string, parameters cluster.Parameters, priority int, origin ...Module) (supervisorId uint64, success bool, description string) {
 
-	provisionerThreadRequest := ProvisionerRequest{Nonce: rand.Uint32(), Cluster: cluster, Action: ProvisionerProvision}
-	if len(config) > 0 {
-		provisionerThreadRequest.Config = config[0]
+	provisionerThreadRequest := ProvisionerRequest{
+		Nonce:      rand.Uint32(),
+		Cluster:    clusterName,
+		Config:     config,
+		Action:     ProvisionerProvision,
+		Parameters: parameters,
+		Priority:   priority,
+	}
+	if len(origin) == 1 {
+		provisionerThreadRequest.Origin = origin[0]
 	}
 	pipe <- provisionerThreadRequest
 
@@ -213,6 +227,33 @@ func SupervisorProvision(pipe chan<- ProvisionerRequest, responseTable *utils.Re
 	}
 }
 
+func SupervisorTeardown(pipe chan<- ProvisionerRequest, responseTable *utils.ResponseTable, cluster string, supervisorId uint64) (success bool, description string) {
+
+	provisionerThreadRequest := ProvisionerRequest{Nonce: rand.Uint32(), Cluster: cluster, Supervisor: supervisorId, Action: ProvisionerTeardown}
+	pipe <- provisionerThreadRequest
+
+	timeout := false
+	var provisionerResponse ProvisionerResponse
+
+	timestamp := time.Now()
+	for {
+		if time.Now().Sub(timestamp).Seconds() > GetConfigInstance().MaxWaitForResponse {
+			timeout = true
+			break
+		}
+
+		if responseEntry, found := responseTable.Lookup(provisionerThreadRequest.Nonce); found {
+			provisionerResponse = (responseEntry).(ProvisionerResponse)
+			break
+		}
+	}
+
+	if timeout {
+		return false, "timed out waiting on the provisioner"
+	}
+	return provisionerResponse.Success, provisionerResponse.Description
+}
+
 func ClusterList() (clusters map[string]bool, success bool) {
 
 	provisionerInstance := GetProvisionerInstance()
@@ -239,6 +280,162 @@ func SupervisorLookup(clusterId string, supervisorId uint64) (supervisorInstance
 	return clusterRegistry.GetSupervisor(supervisorId)
 }
 
+func DeadLetterLookup(clusterId string) (store *deadletter.Store, success bool) {
+
+	provisionerInstance := GetProvisionerInstance()
+
+	clusterRegistry, found := provisionerInstance.GetRegistry(clusterId)
+	if !found {
+		return nil, false
+	}
+
+	return clusterRegistry.DeadLetters(), true
+}
+
+func DeadLetterResubmit(clusterId string, recordId uint64) (success bool, description string) {
+
+	provisionerInstance := GetProvisionerInstance()
+
+	clusterRegistry, found := provisionerInstance.GetRegistry(clusterId)
+	if !found {
+		return false, "cluster not found"
+	}
+
+	return clusterRegistry.Resubmit(recordId)
+}
+
+// AdmissionQueue returns the supervisors waiting to be admitted along with the limits and how long supervisors waited
+func AdmissionQueue() (metrics provisioner.AdmissionMetrics, queue []provisioner.QueueEntry) {
+	return GetProvisionerInstance().AdmissionMetrics(), GetProvisionerInstance().Queue()
+}
+
+func AdmissionLookup(clusterId string, supervisorId uint64) (entry provisioner.QueueEntry, success bool) {
+	return GetProvisionerInstance().Position(clusterId, supervisorId)
+}
+
+func JournalList() []journal.Entry {
+
+	if journalInstance == nil {
+		return []journal.Entry{}
+	}
+	return journalInstance.List()
+}
+
+func JournalLookup(id uint64) (entry journal.Entry, success bool) {
+
+	if journalInstance == nil {
+		return entry, false
+	}
+	return journalInstance.Get(id)
+}
+
+func ScheduleList() []scheduler.Status {
+	return GetSchedulerInstance().List()
+}
+
+func ScheduleLookup(name string) (status scheduler.Status, success bool) {
+	return GetSchedulerInstance().Get(name)
+}
+
+func ScheduleCreate(schedule scheduler.Schedule) (success bool, description string) {
+
+	if _, found := GetProvisionerInstance().Function(schedule.Cluster); !found {
+		return false, "cluster not found"
+	}
+
+	return GetSchedulerInstance().Add(schedule)
+}
+
+func ScheduleDelete(name string) (success bool) {
+	return GetSchedulerInstance().Remove(name)
+}
+
+func TriggerList() []trigger.Status {
+	return GetTriggerInstance().List()
+}
+
+func TriggerLookup(name string) (status trigger.Status, success bool) {
+	return GetTriggerInstance().Get(name)
+}
+
+func TriggerCreate(definition trigger.Trigger) (success bool, description string) {
+
+	if _, found := GetProvisionerInstance().Function(definition.Cluster); !found {
+		return false, "cluster not found"
+	}
+
+	return GetTriggerInstance().Add(definition)
+}
+
+func TriggerDelete(name string) (success bool) {
+	return GetTriggerInstance().Remove(name)
+}
+
+func WorkflowList() []workflow.Workflow {
+	return GetWorkflowInstance().List()
+}
+
+func WorkflowLookup(name string) (definition workflow.Workflow, success bool) {
+	return GetWorkflowInstance().Get(name)
+}
+
+func WorkflowCreate(definition workflow.Workflow) (success bool, description string) {
+
+	for _, node := range definition.Nodes {
+		if _, found := GetProvisionerInstance().Function(node.Cluster); !found {
+			return false, fmt.Sprintf("cluster %s not found", node.Cluster)
+		}
+	}
+
+	return GetWorkflowInstance().Define(definition)
+}
+
+func WorkflowDelete(name string) (success bool) {
+	return GetWorkflowInstance().Remove(name)
+}
+
+func WorkflowStart(pipe chan<- ProvisionerRequest, responseTable *utils.ResponseTable, name string, parameters cluster.Parameters) (runId uint64, success bool, description string) {
+
+	provisionerThreadRequest := ProvisionerRequest{
+		Nonce:      rand.Uint32(),
+		Action:     ProvisionerWorkflow,
+		Workflow:   name,
+		Parameters: parameters,
+	}
+	pipe <- provisionerThreadRequest
+
+	timeout := false
+	var provisionerResponse ProvisionerResponse
+
+	timestamp := time.Now()
+	for {
+		if time.Now().Sub(timestamp).Seconds() > GetConfigInstance().MaxWaitForResponse {
+			timeout = true
+			break
+		}
+
+		if responseEntry, found := responseTable.Lookup(provisionerThreadRequest.Nonce); found {
+			provisionerResponse = (responseEntry).(ProvisionerResponse)
+			break
+		}
+	}
+
+	if timeout {
+		return 0, false, "timed out waiting on the provisioner"
+	}
+	return provisionerResponse.Run, provisionerResponse.Success, provisionerResponse.Description
+}
+
+// WorkflowRunLookup returns the status of the run along with the status of every node in it
+func WorkflowRunLookup(runId uint64) (status workflow.Status, success bool) {
+	return GetWorkflowInstance().Run(runId)
+}
+
+// WorkflowRunList returns the runs of the workflow, or of every workflow if the name is empty
+func WorkflowRunList(name string) []workflow.Status {
+	return GetWorkflowInstance().Runs(name)
+}
+
 func FindStatistics(pipe chan<- DatabaseRequest, responseTable *utils.ResponseTable, clusterName string) (entries []database.Entry, found bool) {
 
 	databaseRequest := DatabaseRequest{Action: DatabaseFetch, Type: database.Statistic, Nonce: rand.Uint32(), Cluster: clusterName}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAwaitTeardown(t *testing.T) {
+	const grace, wait = 50 * time.Millisecond, 50 * time.Millisecond
+
+	// the provisioner finishes within the grace period
+	done := make(chan struct{})
+	close(done)
+	terminated, abandoned := awaitTeardown(done, nil, grace, func() { t.Error("expected nothing to be terminated") }, wait)
+	if terminated || abandoned {
+		t.Error("expected the provisioner to tear down without being terminated")
+	}
+
+	// the grace period passes and the supervisors return once they are terminated
+	done = make(chan struct{})
+	terminated, abandoned = awaitTeardown(done, nil, grace, func() { close(done) }, wait)
+	if !terminated || abandoned {
+		t.Error("expected the supervisors to be terminated once the grace period passed")
+	}
+
+	// a second interrupt skips the grace period
+	done, skip := make(chan struct{}), make(chan struct{})
+	close(skip)
+	start := time.Now()
+	terminated, _ = awaitTeardown(done, skip, time.Hour, func() { close(done) }, wait)
+	if !terminated || (time.Since(start) > time.Second) {
+		t.Error("expected the supervisors to be terminated without waiting for the grace period")
+	}
+
+	// supervisors that ignore the termination are abandoned after the terminate wait
+	calls := 0
+	terminated, abandoned = awaitTeardown(make(chan struct{}), nil, grace, func() { calls++ }, wait)
+	if !terminated || !abandoned || (calls != 1) {
+		t.Errorf("expected the supervisors to be terminated once and then abandoned, got %d calls", calls)
+	}
+}
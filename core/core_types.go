@@ -2,6 +2,9 @@ package core
 
 import (
 	"github.com/GabeCordo/etl/components/messenger"
+	"github.com/GabeCordo/etl/components/scheduler"
+	"github.com/GabeCordo/etl/components/trigger"
+	"github.com/GabeCordo/etl/components/workflow"
 	"github.com/GabeCordo/fack"
 )
 
@@ -20,6 +23,8 @@ const (
 	Provisioner        = 2
 	Messenger          = 3
 	Cache              = 4
+	Scheduler          = 5
+	Trigger            = 6
 )
 
 type Thread interface {
@@ -51,8 +56,16 @@ type Config struct {
 		} `json:"smtp,omitempty"`
 		EnableSmtp bool `json:"enable-smtp"`
 	} `json:"messenger"`
-	Net  fack.Address `json:"net"`
-	Path string
+	Admission struct {
+		MaxConcurrentSupervisors int            `json:"max-concurrent-supervisors,omitempty"` // across every cluster, 24 if not given
+		Clusters                 map[string]int `json:"clusters,omitempty"`                   // the most supervisors of a cluster running at once
+	} `json:"admission,omitempty"`
+	Journal   string               `json:"journal,omitempty"`   // where the runs accepted by the node are journaled, they are not recovered if empty
+	Schedules []scheduler.Schedule `json:"schedules,omitempty"` // clusters provisioned on a cron expression or an interval
+	Workflows []workflow.Workflow  `json:"workflows,omitempty"` // clusters chained into a DAG, run over the api
+	Triggers  []trigger.Trigger    `json:"triggers,omitempty"`  // clusters provisioned for every file that lands in a directory
+	Net       fack.Address         `json:"net"`
+	Path      string
 }
 
 func (c *Config) Safe() *Config {
@@ -69,6 +82,8 @@ type Core struct {
 	MessengerThread   *MessengerThread
 	DatabaseThread    *DatabaseThread
 	CacheThread       *CacheThread
+	SchedulerThread   *SchedulerThread
+	TriggerThread     *TriggerThread
 
 	C1        chan DatabaseRequest
 	C2        chan DatabaseResponse
@@ -81,5 +96,9 @@ type Core struct {
 	C9        chan CacheRequest
 	C10       chan CacheResponse
 	C11       chan MessengerRequest
+	C12       chan ProvisionerRequest
+	C13       chan ProvisionerResponse
+	C14       chan ProvisionerRequest
+	C15       chan ProvisionerResponse
 	interrupt chan InterruptEvent
 }
@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/provisioner"
+	"github.com/GabeCordo/etl/components/scheduler"
+	"github.com/GabeCordo/etl/components/trigger"
+	"github.com/GabeCordo/etl/components/workflow"
 	"log"
 	"net/http"
 	"net/url"
@@ -77,9 +81,11 @@ func (httpThread *HttpThread) clusterCallback(w http.ResponseWriter, r *http.Req
 }
 
 type SupervisorConfigJSONBody struct {
-	Cluster    string `json:"cluster"`
-	Config     string `json:"config"`
-	Supervisor uint64 `json:"id,omitempty"`
+	Cluster    string             `json:"cluster"`
+	Config     string             `json:"config"`
+	Supervisor uint64             `json:"id,omitempty"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+	Priority   int                `json:"priority,omitempty"` // queued supervisors with a higher priority are admitted first
 }
 
 type SupervisorProvisionJSONResponse struct {
@@ -93,7 +99,7 @@ func (httpThread *HttpThread) supervisorCallback(w http.ResponseWriter, r *http.
 
 	var request SupervisorConfigJSONBody
 	err := json.NewDecoder(r.Body).Decode(&request)
-	if (r.Method != "GET") && (err != nil) {
+	if (r.Method != "GET") && (r.Method != "DELETE") && (err != nil) {
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
@@ -120,7 +126,7 @@ func (httpThread *HttpThread) supervisorCallback(w http.ResponseWriter, r *http.
 			}
 		}
 	} else if r.Method == "POST" {
-		if supervisorId, success, description := SupervisorProvision(httpThread.C5, httpThread.provisionerResponseTable, request.Cluster, request.Config); success {
+		if supervisorId, success, description := SupervisorProvision(httpThread.C5, httpThread.provisionerResponseTable, request.Cluster, request.Config, request.Parameters, request.Priority); success {
 			response := &SupervisorProvisionJSONResponse{Cluster: request.Cluster, Supervisor: supervisorId}
 			bytes, _ := json.Marshal(response)
 			if _, err := w.Write(bytes); err != nil {
@@ -130,6 +136,29 @@ func (httpThread *HttpThread) supervisorCallback(w http.ResponseWriter, r *http.
 			w.WriteHeader(http.StatusBadRequest)
 			w.Write([]byte(description))
 		}
+	} else if r.Method == "DELETE" {
+
+		clusterName, foundClusterName := urlMapping["cluster"]
+		supervisorIdStr, foundSupervisorId := urlMapping["id"]
+
+		if !foundSupervisorId || !foundClusterName {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			if supervisorId, err := strconv.ParseUint(supervisorIdStr[0], 10, 64); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+			} else {
+				if success, description := SupervisorTeardown(httpThread.C5, httpThread.provisionerResponseTable, clusterName[0], supervisorId); !success {
+					if (description == "cluster not found") || (description == "supervisor not found") {
+						w.WriteHeader(http.StatusNotFound)
+					} else if description == "supervisor already completed" {
+						w.WriteHeader(http.StatusConflict)
+					} else {
+						w.WriteHeader(http.StatusInternalServerError)
+					}
+					w.Write([]byte(description))
+				}
+			}
+		}
 	} else {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 	}
@@ -212,6 +241,387 @@ func (httpThread *HttpThread) statisticCallback(w http.ResponseWriter, r *http.R
 	}
 }
 
+type DeadLetterJSONBody struct {
+	Cluster string `json:"cluster"`
+	Id      uint64 `json:"id"`
+}
+
+type DeadLetterPurgeJSONResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (httpThread *HttpThread) deadLetterCallback(w http.ResponseWriter, r *http.Request) {
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var request DeadLetterJSONBody
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if (r.Method == "POST") && (err != nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == "POST" {
+		// re-submit the record to the stage that rejected it
+		if success, description := DeadLetterResubmit(request.Cluster, request.Id); !success {
+			if (description == "cluster not found") || (description == "record not found") {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(http.StatusConflict)
+			}
+			w.Write([]byte(description))
+		}
+		return
+	}
+
+	clusterName, foundClusterName := urlMapping["cluster"]
+	if !foundClusterName {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	store, found := DeadLetterLookup(clusterName[0])
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	// an id narrows the request down to a single record
+	recordIdStr, foundRecordId := urlMapping["id"]
+	var recordId uint64
+	if foundRecordId {
+		if recordId, err = strconv.ParseUint(recordIdStr[0], 10, 64); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	var data any
+	if r.Method == "GET" {
+		if !foundRecordId {
+			data = store.List()
+		} else if record, found := store.Get(recordId); found {
+			data = record
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else if r.Method == "DELETE" {
+		if !foundRecordId {
+			data = DeadLetterPurgeJSONResponse{Purged: store.Purge()}
+		} else if _, found := store.Remove(recordId); found {
+			data = DeadLetterPurgeJSONResponse{Purged: 1}
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (httpThread *HttpThread) scheduleCallback(w http.ResponseWriter, r *http.Request) {
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var request scheduler.Schedule
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if (r.Method == "POST") && (err != nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name, foundName := urlMapping["name"]
+
+	var data any
+	if r.Method == "GET" {
+		// a name narrows the request down to a single schedule
+		if !foundName {
+			data = ScheduleList()
+		} else if status, found := ScheduleLookup(name[0]); found {
+			data = status
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else if r.Method == "POST" {
+		if success, description := ScheduleCreate(request); !success {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(description))
+			return
+		}
+		data, _ = ScheduleLookup(request.Name)
+	} else if r.Method == "DELETE" {
+		if !foundName {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if !ScheduleDelete(name[0]) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (httpThread *HttpThread) triggerCallback(w http.ResponseWriter, r *http.Request) {
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var request trigger.Trigger
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if (r.Method == "POST") && (err != nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name, foundName := urlMapping["name"]
+
+	var data any
+	if r.Method == "GET" {
+		// a name narrows the request down to a single trigger
+		if !foundName {
+			data = TriggerList()
+		} else if status, found := TriggerLookup(name[0]); found {
+			data = status
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else if r.Method == "POST" {
+		if success, description := TriggerCreate(request); !success {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(description))
+			return
+		}
+		data, _ = TriggerLookup(request.Name)
+	} else if r.Method == "DELETE" {
+		if !foundName {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if !TriggerDelete(name[0]) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (httpThread *HttpThread) workflowCallback(w http.ResponseWriter, r *http.Request) {
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var request workflow.Workflow
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if (r.Method == "POST") && (err != nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	name, foundName := urlMapping["name"]
+
+	var data any
+	if r.Method == "GET" {
+		// a name narrows the request down to a single workflow
+		if !foundName {
+			data = WorkflowList()
+		} else if definition, found := WorkflowLookup(name[0]); found {
+			data = definition
+		} else {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+	} else if r.Method == "POST" {
+		if success, description := WorkflowCreate(request); !success {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(description))
+			return
+		}
+		data = request
+	} else if r.Method == "DELETE" {
+		if !foundName {
+			w.WriteHeader(http.StatusBadRequest)
+		} else if !WorkflowDelete(name[0]) {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		return
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type WorkflowRunJSONBody struct {
+	Workflow   string             `json:"workflow"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+}
+
+type WorkflowRunJSONResponse struct {
+	Workflow string `json:"workflow"`
+	Run      uint64 `json:"id"`
+}
+
+func (httpThread *HttpThread) workflowRunCallback(w http.ResponseWriter, r *http.Request) {
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var request WorkflowRunJSONBody
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if (r.Method == "POST") && (err != nil) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var data any
+	if r.Method == "GET" {
+		// an id narrows the request down to a single run, a workflow to the runs of that workflow
+		if runIdStr, foundRunId := urlMapping["id"]; foundRunId {
+			runId, err := strconv.ParseUint(runIdStr[0], 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			status, found := WorkflowRunLookup(runId)
+			if !found {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			data = status
+		} else if name, foundName := urlMapping["workflow"]; foundName {
+			data = WorkflowRunList(name[0])
+		} else {
+			data = WorkflowRunList("")
+		}
+	} else if r.Method == "POST" {
+		runId, success, description := WorkflowStart(httpThread.C5, httpThread.provisionerResponseTable, request.Workflow, request.Parameters)
+		if !success {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(description))
+			return
+		}
+		data = WorkflowRunJSONResponse{Workflow: request.Workflow, Run: runId}
+	} else {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+type QueueJSONResponse struct {
+	provisioner.AdmissionMetrics
+	Queue []provisioner.QueueEntry `json:"queue"`
+}
+
+func (httpThread *HttpThread) queueCallback(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var data any
+
+	// a cluster and id narrow the request down to the place of a single supervisor in the queue
+	clusterName, foundClusterName := urlMapping["cluster"]
+	supervisorIdStr, foundSupervisorId := urlMapping["id"]
+	if foundClusterName && foundSupervisorId {
+		supervisorId, err := strconv.ParseUint(supervisorIdStr[0], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		entry, found := AdmissionLookup(clusterName[0], supervisorId)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data = entry
+	} else {
+		metrics, queue := AdmissionQueue()
+		data = QueueJSONResponse{AdmissionMetrics: metrics, Queue: queue}
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+func (httpThread *HttpThread) journalCallback(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != "GET" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlMapping, _ := url.ParseQuery(r.URL.RawQuery)
+
+	var data any
+
+	if idStr, found := urlMapping["id"]; found {
+		id, err := strconv.ParseUint(idStr[0], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		entry, found := JournalLookup(id)
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data = entry
+	} else {
+		data = JournalList()
+	}
+
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	} else if _, err := w.Write(bytes); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
 type DebugJSONBody struct {
 	Action string `json:"action"`
 }
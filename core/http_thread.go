@@ -35,6 +35,34 @@ func (httpThread *HttpThread) Setup() {
 		httpThread.configCallback(w, r)
 	})
 
+	mux.HandleFunc("/deadletter", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.deadLetterCallback(w, r)
+	})
+
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.queueCallback(w, r)
+	})
+
+	mux.HandleFunc("/journal", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.journalCallback(w, r)
+	})
+
+	mux.HandleFunc("/schedule", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.scheduleCallback(w, r)
+	})
+
+	mux.HandleFunc("/trigger", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.triggerCallback(w, r)
+	})
+
+	mux.HandleFunc("/workflow", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.workflowCallback(w, r)
+	})
+
+	mux.HandleFunc("/workflow/run", func(w http.ResponseWriter, r *http.Request) {
+		httpThread.workflowRunCallback(w, r)
+	})
+
 	mux.HandleFunc("/debug", func(w http.ResponseWriter, r *http.Request) {
 		httpThread.debugCallback(w, r)
 	})
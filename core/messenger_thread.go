@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"github.com/GabeCordo/etl/components/messenger"
 	"log"
 )
@@ -103,7 +104,12 @@ func (messengerThread *MessengerThread) ProcessConsoleRequest(request *Messenger
 		priority = messenger.Fatal
 	}
 
-	messengerInstance.Log(request.Cluster, request.Message, priority)
+	message := request.Message
+	if request.Supervisor != 0 {
+		message = fmt.Sprintf("(supervisor %d) %s", request.Supervisor, message)
+	}
+
+	messengerInstance.Log(request.Cluster, message, priority)
 }
 
 func (messengerThread *MessengerThread) ProcessCloseLogRequest(request *MessengerRequest) {
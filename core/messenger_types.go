@@ -15,6 +15,7 @@ const (
 type MessengerRequest struct {
 	Action     MessengerAction `json:"action"`
 	Cluster    string          `json:"cluster"`
+	Supervisor uint64          `json:"supervisor,omitempty"` // the supervisor the message is attributed to, 0 for the cluster as a whole
 	Nonce      uint32          `json:"nonce"`
 	Message    string          `json:"message"`
 	Parameters []string        `json:"parameters"`
@@ -1,7 +1,9 @@
 package core
 
 import (
+	"github.com/GabeCordo/etl/components/utils"
 	"math/rand"
+	"time"
 )
 
 type Helper struct {
@@ -70,3 +72,65 @@ func (helper Helper) Fatal(cluster, message string) {
 	requestNonce := rand.Uint32()
 	helper.core.C11 <- MessengerRequest{Action: MessengerFatal, Cluster: cluster, Message: message, Nonce: requestNonce}
 }
+
+// runLogger sends the messages logged by the stages of a supervisor to the messenger, attributed to the supervisor
+type runLogger struct {
+	pipe       chan<- MessengerRequest
+	cluster    string
+	supervisor uint64
+}
+
+func (logger runLogger) Log(message string) {
+	logger.pipe <- MessengerRequest{Action: MessengerLog, Cluster: logger.cluster, Supervisor: logger.supervisor, Message: message, Nonce: rand.Uint32()}
+}
+
+func (logger runLogger) Warning(message string) {
+	logger.pipe <- MessengerRequest{Action: MessengerWarning, Cluster: logger.cluster, Supervisor: logger.supervisor, Message: message, Nonce: rand.Uint32()}
+}
+
+func (logger runLogger) Fatal(message string) {
+	logger.pipe <- MessengerRequest{Action: MessengerFatal, Cluster: logger.cluster, Supervisor: logger.supervisor, Message: message, Nonce: rand.Uint32()}
+}
+
+// runCache saves to and loads from the cache thread on behalf of the stages of a supervisor
+type runCache struct {
+	pipe          chan<- CacheRequest
+	responseTable *utils.ResponseTable
+}
+
+func (c runCache) Save(data any) (identifier string, success bool) {
+
+	var expiry float64
+	if GetConfigInstance().Cache.Expiry != 0.0 {
+		expiry = GetConfigInstance().Cache.Expiry
+	} else {
+		expiry = DefaultTimeout
+	}
+
+	response, ok := c.send(CacheRequest{Action: CacheSaveIn, Data: data, Nonce: rand.Uint32(), ExpiresIn: expiry})
+	return response.Identifier, ok
+}
+
+func (c runCache) Load(identifier string) (data any, success bool) {
+
+	response, ok := c.send(CacheRequest{Action: CacheLoadFrom, Identifier: identifier, Nonce: rand.Uint32()})
+	return response.Data, ok
+}
+
+// send waits for the cache thread to respond to the request, false if it fails or takes longer than the max-wait-for-response
+func (c runCache) send(request CacheRequest) (CacheResponse, bool) {
+
+	c.pipe <- request
+
+	timestamp := time.Now()
+	for {
+		if time.Now().Sub(timestamp).Seconds() > GetConfigInstance().MaxWaitForResponse {
+			return CacheResponse{}, false
+		}
+
+		if responseEntry, found := c.responseTable.Lookup(request.Nonce); found {
+			response := (responseEntry).(CacheResponse)
+			return response, response.Success
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/journal"
+	"github.com/GabeCordo/etl/components/utils"
+	"log"
+)
+
+// ProcessRecoveredRuns
+// Picks back up the runs the journal holds that had not finished when the node stopped. A run that
+// was still pending is provisioned again. A run that was in flight is provisioned again if its
+// config restarts on a crash, and is marked as interrupted otherwise.
+func (provisionerThread *ProvisionerThread) ProcessRecoveredRuns() {
+	defer provisionerThread.wg.Done()
+
+	if provisionerThread.journal == nil {
+		return
+	}
+
+	for _, entry := range provisionerThread.journal.Recovered() {
+		if (entry.State == journal.Running) && ((entry.OnCrash == nil) || (*entry.OnCrash != cluster.Restart)) {
+			provisionerThread.journal.Finish(entry.Id, journal.Interrupted, "the node stopped while the run was in flight")
+			log.Printf("%s[%s]%s Run(%d) was interrupted when the node stopped\n", utils.Green, entry.Cluster, utils.Reset, entry.Id)
+			continue
+		}
+
+		request := &ProvisionerRequest{
+			Cluster:    entry.Cluster,
+			Config:     entry.Config,
+			Parameters: entry.Parameters,
+			Priority:   entry.Priority,
+			Journal:    entry.Id,
+		}
+
+		provisionerThread.wg.Add(1)
+		supervisorInstance, description := provisionerThread.provision(request, nil)
+		if supervisorInstance == nil {
+			provisionerThread.wg.Done()
+			provisionerThread.journal.Finish(entry.Id, journal.Failed, description)
+			log.Printf("%s[%s]%s Could not recover run(%d); %s\n", utils.Green, entry.Cluster, utils.Reset, entry.Id, description)
+			continue
+		}
+
+		log.Printf("%s[%s]%s Recovered run(%d) as supervisor(%d)\n", utils.Green, entry.Cluster, utils.Reset, entry.Id, supervisorInstance.Id)
+	}
+}
+
+// journalAccepted records the run as pending, or as picked back up if it was recovered, returning the id it is journaled under
+func (provisionerThread *ProvisionerThread) journalAccepted(request *ProvisionerRequest, config cluster.Config, supervisorId uint64) uint64 {
+	if provisionerThread.journal == nil {
+		return 0
+	}
+
+	if request.Journal != 0 {
+		if err := provisionerThread.journal.Resume(request.Journal, supervisorId); err != nil {
+			log.Printf("[etl_provisioner] could not journal run(%d); %s\n", request.Journal, err.Error())
+		}
+		return request.Journal
+	}
+
+	id, err := provisionerThread.journal.Enqueue(journal.Entry{
+		Cluster:    request.Cluster,
+		Config:     request.Config,
+		Parameters: request.Parameters,
+		Priority:   request.Priority,
+		OnCrash:    config.Mode,
+		Supervisor: supervisorId,
+	})
+	if err != nil {
+		log.Printf("[etl_provisioner] could not journal supervisor(%d); %s\n", supervisorId, err.Error())
+		return 0
+	}
+	return id
+}
+
+// journalStarted records that the supervisor of the run was admitted
+func (provisionerThread *ProvisionerThread) journalStarted(id uint64) {
+	if (provisionerThread.journal == nil) || (id == 0) {
+		return
+	}
+
+	if err := provisionerThread.journal.Started(id); err != nil {
+		log.Printf("[etl_provisioner] could not journal run(%d); %s\n", id, err.Error())
+	}
+}
+
+// journalFinished records how the run ended, a run terminated because the node is stopping is left in flight to be recovered
+func (provisionerThread *ProvisionerThread) journalFinished(id uint64, response *cluster.Response) {
+	if (provisionerThread.journal == nil) || (id == 0) {
+		return
+	}
+	if response.Stats.TerminatedByDeadline {
+		return
+	}
+
+	state, description := journal.Completed, ""
+	if len(response.SetupError) != 0 {
+		state, description = journal.Failed, "setup failed: "+response.SetupError
+	} else if response.DeadlineExceeded {
+		state, description = journal.Failed, "max-runtime exceeded"
+	} else if response.Cancelled {
+		state = journal.Cancelled
+	} else if response.DidItCrash {
+		state, description = journal.Failed, "crashed"
+	}
+
+	if err := provisionerThread.journal.Finish(id, state, description); err != nil {
+		log.Printf("[etl_provisioner] could not journal run(%d); %s\n", id, err.Error())
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/GabeCordo/etl/components/cluster"
 	"github.com/GabeCordo/etl/components/database"
+	"github.com/GabeCordo/etl/components/journal"
 	"github.com/GabeCordo/etl/components/provisioner"
 	"github.com/GabeCordo/etl/components/supervisor"
 	"github.com/GabeCordo/etl/components/utils"
@@ -19,6 +20,9 @@ const (
 
 var provisionerInstance *provisioner.Provisioner
 
+// journalInstance is only set when the etl config names a journal for the node
+var journalInstance *journal.Journal
+
 func GetProvisionerInstance() *provisioner.Provisioner {
 
 	if provisionerInstance == nil {
@@ -39,6 +43,30 @@ func (provisionerThread *ProvisionerThread) Setup() {
 	for _, identifier := range GetConfigInstance().AutoMount {
 		provisionerInstance.Mount(identifier)
 	}
+
+	// the node and each cluster are held to the limits in the etl config, supervisors over a limit are queued
+	provisionerInstance.SetLimit(GetConfigInstance().Admission.MaxConcurrentSupervisors)
+	for identifier, limit := range GetConfigInstance().Admission.Clusters {
+		provisionerInstance.SetClusterLimit(identifier, limit)
+	}
+
+	// the runs the node accepts are journaled so they survive it stopping, if the etl config names a journal
+	if path := GetConfigInstance().Journal; len(path) != 0 {
+		if runJournal, err := journal.Open(path); err == nil {
+			provisionerThread.journal = runJournal
+			journalInstance = runJournal
+		} else {
+			log.Printf("[etl_provisioner] could not open the journal %s; %s\n", path, err.Error())
+		}
+	}
+
+	// workflows declared in the etl config are defined on startup, any others are created over the api
+	workflowInstance := GetWorkflowInstance()
+	for _, definition := range GetConfigInstance().Workflows {
+		if success, description := workflowInstance.Define(definition); !success {
+			log.Printf("%s[%s]%s Could not define workflow; %s\n", utils.Green, definition.Name, utils.Reset, description)
+		}
+	}
 }
 
 func (provisionerThread *ProvisionerThread) Start() {
@@ -56,6 +84,34 @@ func (provisionerThread *ProvisionerThread) Start() {
 
 		provisionerThread.wg.Wait()
 	}()
+	go func() {
+		// request coming from the scheduler
+		for request := range provisionerThread.C12 {
+			if !provisionerThread.accepting {
+				break
+			}
+			provisionerThread.wg.Add(1)
+
+			// if this doesn't spawn its own thread we will be left waiting
+			provisionerThread.ProcessIncomingRequests(&request)
+		}
+
+		provisionerThread.wg.Wait()
+	}()
+	go func() {
+		// request coming from the trigger thread
+		for request := range provisionerThread.C14 {
+			if !provisionerThread.accepting {
+				break
+			}
+			provisionerThread.wg.Add(1)
+
+			// if this doesn't spawn its own thread we will be left waiting
+			provisionerThread.ProcessIncomingRequests(&request)
+		}
+
+		provisionerThread.wg.Wait()
+	}()
 	go func() {
 		for response := range provisionerThread.C8 {
 			if !provisionerThread.accepting {
@@ -81,9 +137,28 @@ func (provisionerThread *ProvisionerThread) Start() {
 		provisionerThread.wg.Wait()
 	}()
 
+	// runs the node accepted before it last stopped are picked back up once responses from the database are read
+	provisionerThread.wg.Add(1)
+	go provisionerThread.ProcessRecoveredRuns()
+
 	provisionerThread.wg.Wait()
 }
 
+// Send returns the response to the thread the request came from
+func (provisionerThread *ProvisionerThread) Send(request *ProvisionerRequest, response *ProvisionerResponse) {
+	switch request.Origin {
+	case Http:
+		provisionerThread.C6 <- *response
+		break
+	case Scheduler:
+		provisionerThread.C13 <- *response
+		break
+	case Trigger:
+		provisionerThread.C15 <- *response
+		break
+	}
+}
+
 func (provisionerThread *ProvisionerThread) ProcessIncomingRequests(request *ProvisionerRequest) {
 
 	if request.Action == ProvisionerMount {
@@ -93,13 +168,15 @@ func (provisionerThread *ProvisionerThread) ProcessIncomingRequests(request *Pro
 	} else if request.Action == ProvisionerProvision {
 		provisionerThread.ProcessProvisionRequest(request)
 	} else if request.Action == ProvisionerTeardown {
-		// TODO - not implemented
+		provisionerThread.ProcessTeardownRequest(request)
 	} else if request.Action == ProvisionerLowerPing {
 		provisionerThread.ProcessPingProvisionerRequest(request)
 	} else if request.Action == ProvisionerDynamicLoad {
 		provisionerThread.ProcessDynamicClusterLoad(request)
 	} else if request.Action == ProvisionerDynamicDelete {
 		provisionerThread.ProcessDynamicClusterDelete(request)
+	} else if request.Action == ProvisionerWorkflow {
+		provisionerThread.ProcessWorkflowRequest(request)
 	}
 }
 
@@ -129,7 +206,7 @@ func (provisionerThread *ProvisionerThread) ProcessPingProvisionerRequest(reques
 	}
 
 	if databasePingTimeout || !databaseResponse.Success {
-		provisionerThread.C6 <- ProvisionerResponse{Nonce: request.Nonce, Success: false}
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false})
 		provisionerThread.wg.Done()
 		return
 	}
@@ -159,7 +236,7 @@ func (provisionerThread *ProvisionerThread) ProcessPingProvisionerRequest(reques
 
 	if cachePingTimeout || !cacheResponse.Success {
 		log.Println("[etl_provisioner] failed to receive ping over C10")
-		provisionerThread.C6 <- ProvisionerResponse{Nonce: request.Nonce, Success: false}
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false})
 		provisionerThread.wg.Done()
 		return
 	}
@@ -168,7 +245,7 @@ func (provisionerThread *ProvisionerThread) ProcessPingProvisionerRequest(reques
 		log.Println("[etl_provisioner] received ping over C10")
 	}
 
-	provisionerThread.C6 <- ProvisionerResponse{Nonce: request.Nonce, Success: true}
+	provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: true})
 
 	provisionerThread.wg.Done()
 }
@@ -178,7 +255,7 @@ func (provisionerThread *ProvisionerThread) ProcessMountRequest(request *Provisi
 	GetProvisionerInstance().Mount(request.Cluster)
 
 	success := GetProvisionerInstance().IsMounted(request.Cluster)
-	provisionerThread.C6 <- ProvisionerResponse{Success: success, Nonce: request.Nonce}
+	provisionerThread.Send(request, &ProvisionerResponse{Success: success, Nonce: request.Nonce})
 
 	if GetConfigInstance().Debug && success {
 		log.Printf("%s[%s]%s Mounted cluster\n", utils.Green, request.Cluster, utils.Reset)
@@ -192,7 +269,7 @@ func (provisionerThread *ProvisionerThread) ProcessUnMountRequest(request *Provi
 	GetProvisionerInstance().UnMount(request.Cluster)
 
 	success := !GetProvisionerInstance().IsMounted(request.Cluster)
-	provisionerThread.C6 <- ProvisionerResponse{Success: success, Nonce: request.Nonce}
+	provisionerThread.Send(request, &ProvisionerResponse{Success: success, Nonce: request.Nonce})
 
 	if GetConfigInstance().Debug && success {
 		log.Printf("%s[%s]%s UnMounted cluster\n", utils.Green, request.Cluster, utils.Reset)
@@ -203,23 +280,47 @@ func (provisionerThread *ProvisionerThread) ProcessUnMountRequest(request *Provi
 
 func (provisionerThread *ProvisionerThread) ProcessProvisionRequest(request *ProvisionerRequest) {
 
+	supervisorInstance, description := provisionerThread.provision(request, nil)
+	if supervisorInstance == nil {
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false, Description: description})
+		provisionerThread.wg.Done()
+		return
+	}
+
+	provisionerThread.Send(request, &ProvisionerResponse{
+		Nonce:        request.Nonce,
+		Success:      true,
+		Cluster:      request.Cluster,
+		SupervisorId: supervisorInstance.Id,
+	})
+}
+
+// provision
+// Creates a supervisor for the cluster and starts it on a goroutine of its own, returning nil and why
+// if the cluster could not be provisioned. The goroutine counts against the wait group, and calls
+// the completion, if there is one, with the response of the supervisor once it has been stored.
+func (provisionerThread *ProvisionerThread) provision(request *ProvisionerRequest, completion func(response *cluster.Response)) (*supervisor.Supervisor, string) {
+
 	provisionerInstance := GetProvisionerInstance()
 
 	if !provisionerInstance.IsMounted(request.Cluster) {
 		log.Printf("%s[%s]%s Could not provision cluster; cluster was not mounted\n", utils.Green, request.Cluster, utils.Reset)
-		provisionerThread.C6 <- ProvisionerResponse{Nonce: request.Nonce, Success: false}
-		provisionerThread.wg.Done()
-		return
+		return nil, "cluster not mounted"
 	} else {
 		log.Printf("%s[%s]%s Provisioning cluster\n", utils.Green, request.Cluster, utils.Reset)
 	}
 
-	_, ok := provisionerInstance.Function(request.Cluster)
+	clusterImplementation, ok := provisionerInstance.Function(request.Cluster)
 	if !ok {
 		log.Printf("%s[%s]%s There is a corrupted cluster in the supervisor\n", utils.Green, request.Cluster, utils.Reset)
-		provisionerThread.C6 <- ProvisionerResponse{Nonce: request.Nonce, Success: false}
-		provisionerThread.wg.Done()
-		return
+		return nil, "cluster not found"
+	}
+
+	// the parameters are checked against the schema the cluster declares before a supervisor is created for them
+	parameters, valid, description := cluster.ValidateParameters(clusterImplementation, request.Parameters)
+	if !valid {
+		log.Printf("%s[%s]%s Could not provision cluster; %s\n", utils.Green, request.Cluster, utils.Reset, description)
+		return nil, description
 	}
 
 	// if the operator does not specify a config to use, the system shall use the cluster identifier name
@@ -229,14 +330,16 @@ func (provisionerThread *ProvisionerThread) ProcessProvisionRequest(request *Pro
 	}
 
 	config, configFound := GetConfigFromDatabase(provisionerThread.C7, provisionerThread.databaseResponseTable, request.Config)
-	config.Print()
-	fmt.Println(configFound)
 	if !configFound {
 		// the config was either never created or deleted from the database.
 		// INSTEAD of continuing, the node should inform the user that the client cannot use the config they want
-		provisionerThread.C6 <- ProvisionerResponse{Success: false, Description: "config not found", Nonce: request.Nonce}
-		provisionerThread.wg.Done()
-		return
+		return nil, "config not found"
+	}
+
+	// a misspelled or unregistered policy should not quietly fall back to the threshold policy
+	if !supervisor.IsScalingPolicy(config.ScalingPolicy) {
+		log.Printf("%s[%s]%s Could not provision cluster; scaling policy %s not found\n", utils.Green, request.Cluster, utils.Reset, config.ScalingPolicy)
+		return nil, "scaling policy not found"
 	}
 
 	registryInstance, _ := provisionerInstance.GetRegistry(request.Cluster)
@@ -244,29 +347,60 @@ func (provisionerThread *ProvisionerThread) ProcessProvisionRequest(request *Pro
 	var supervisorInstance *supervisor.Supervisor
 	if configFound {
 		log.Printf("%s[%s]%s Initializing cluster supervisor from config\n", utils.Green, request.Cluster, utils.Reset)
-		config.Print()
+		if GetConfigInstance().Debug {
+			config.Print()
+		}
 		supervisorInstance = registryInstance.CreateSupervisor(config)
 	} else {
 		log.Printf("%s[%s]%s Initializing cluster supervisor\n", utils.Green, request.Cluster, utils.Reset)
 		supervisorInstance = registryInstance.CreateSupervisor()
 	}
 
+	supervisorInstance.SetParameters(parameters)
+	// the stages log and cache through their run, so everything they do is attributed to this supervisor
+	supervisorInstance.SetLogger(runLogger{pipe: provisionerThread.C11, cluster: config.Identifier, supervisor: supervisorInstance.Id})
+	supervisorInstance.SetCache(runCache{pipe: provisionerThread.C9, responseTable: provisionerThread.cacheResponseTable})
+
 	log.Printf("%s[%s]%s Supervisor(%d) registered to cluster(%s)\n", utils.Green, request.Cluster, utils.Reset, supervisorInstance.Id, request.Cluster)
 
-	provisionerThread.C6 <- ProvisionerResponse{
-		Nonce:        request.Nonce,
-		Success:      true,
-		Cluster:      request.Cluster,
-		SupervisorId: supervisorInstance.Id,
-	}
+	// the run is journaled once it is accepted so it can be picked back up if the node stops before it completes
+	journalId := provisionerThread.journalAccepted(request, config, supervisorInstance.Id)
 
 	log.Printf("%s[%s]%s Cluster Running\n", utils.Green, request.Cluster, utils.Reset)
 
 	go func() {
 
-		// block until the supervisor completes
-		supervisorInstance.Print()
-		response := supervisorInstance.Start()
+		// the supervisor is queued while the node or the cluster is running as many supervisors as it is allowed,
+		// one stopped while it is queued is never admitted and finishes cancelled without running
+		var response *cluster.Response
+		switch provisionerInstance.Admit(request.Cluster, supervisorInstance, request.Priority) {
+		case provisioner.Admitted:
+			provisionerThread.journalStarted(journalId)
+
+			// block until the supervisor completes
+			if GetConfigInstance().Debug {
+				supervisorInstance.Print()
+			}
+			response = supervisorInstance.Start()
+			provisionerInstance.Release(request.Cluster)
+			provisionerThread.journalFinished(journalId, response)
+		case provisioner.Withdrawn:
+			// the node stopped accepting work while the supervisor was queued, the run is left pending
+			// in the journal so that it is picked back up once the node starts again
+			log.Printf("%s[%s]%s Supervisor(%d) withdrawn from the queue\n", utils.Green, request.Cluster, utils.Reset, supervisorInstance.Id)
+			supervisorInstance.Stop()
+			response = supervisorInstance.Start()
+		case provisioner.Unregistered:
+			// the cluster was un-registered before the supervisor could be admitted, it cannot run without a slot
+			supervisorInstance.Event(supervisor.Error)
+			response = cluster.NewResponse(supervisorInstance.Config, supervisorInstance.Statistics(), 0, true)
+			response.Parameters = supervisorInstance.Parameters
+			response.SetupError = "cluster not found"
+			provisionerThread.journalFinished(journalId, response)
+		default:
+			response = supervisorInstance.Start()
+			provisionerThread.journalFinished(journalId, response)
+		}
 
 		// don't send the statistics of the cluster to the database unless an Identifier has been
 		// given to the cluster for grouping purposes
@@ -275,6 +409,31 @@ func (provisionerThread *ProvisionerThread) ProcessProvisionRequest(request *Pro
 			dbRequest := DatabaseRequest{Action: DatabaseStore, Origin: Provisioner, Cluster: supervisorInstance.Config.Identifier, Data: response}
 			provisionerThread.C7 <- dbRequest
 
+			if len(response.SetupError) != 0 {
+				provisionerThread.C11 <- MessengerRequest{
+					Action:     MessengerFatal,
+					Cluster:    supervisorInstance.Config.Identifier,
+					Supervisor: supervisorInstance.Id,
+					Message:    fmt.Sprintf("setup failed: %s", response.SetupError),
+				}
+			}
+
+			if response.DeadlineExceeded {
+				provisionerThread.C11 <- MessengerRequest{
+					Action:     MessengerWarning,
+					Cluster:    supervisorInstance.Config.Identifier,
+					Supervisor: supervisorInstance.Id,
+					Message:    fmt.Sprintf("supervisor %d exceeded its max-runtime before completing", supervisorInstance.Id),
+				}
+			} else if response.Cancelled && !response.Stats.TerminatedByDeadline {
+				provisionerThread.C11 <- MessengerRequest{
+					Action:     MessengerWarning,
+					Cluster:    supervisorInstance.Config.Identifier,
+					Supervisor: supervisorInstance.Id,
+					Message:    fmt.Sprintf("supervisor %d was cancelled before completing", supervisorInstance.Id),
+				}
+			}
+
 			// sends a completion message to the messenger thread to write to a log file or send an email regarding completion
 			msgRequest := MessengerRequest{Action: MessengerClose, Cluster: supervisorInstance.Config.Identifier}
 			provisionerThread.C11 <- msgRequest
@@ -296,10 +455,55 @@ func (provisionerThread *ProvisionerThread) ProcessProvisionRequest(request *Pro
 			}
 		}
 
+		if completion != nil {
+			completion(response)
+		}
+
 		// let the provisioner thread decrement the semaphore otherwise we will be stuck in deadlock waiting for
 		// the provisioned cluster to complete before allowing the etl-framework to shut down
 		provisionerThread.wg.Done()
 	}()
+
+	return supervisorInstance, ""
+}
+
+func (provisionerThread *ProvisionerThread) ProcessTeardownRequest(request *ProvisionerRequest) {
+
+	registryInstance, found := GetProvisionerInstance().GetRegistry(request.Cluster)
+	if !found {
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false, Description: "cluster not found"})
+		provisionerThread.wg.Done()
+		return
+	}
+
+	supervisorInstance, found := registryInstance.GetSupervisor(request.Supervisor)
+	if !found {
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false, Description: "supervisor not found"})
+		provisionerThread.wg.Done()
+		return
+	}
+
+	// a supervisor that already finished has nothing left to cancel
+	if supervisorInstance.IsComplete() {
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false, Description: "supervisor already completed"})
+		provisionerThread.wg.Done()
+		return
+	}
+
+	// the supervisor will finish in a cancelled state, the goroutine that started it is
+	// still responsible for storing the partial response in the database
+	supervisorInstance.Stop()
+
+	log.Printf("%s[%s]%s Supervisor(%d) cancelled by operator\n", utils.Green, request.Cluster, utils.Reset, request.Supervisor)
+
+	provisionerThread.Send(request, &ProvisionerResponse{
+		Nonce:        request.Nonce,
+		Success:      true,
+		Cluster:      request.Cluster,
+		SupervisorId: request.Supervisor,
+	})
+
+	provisionerThread.wg.Done()
 }
 
 func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *ProvisionerRequest) {
@@ -315,7 +519,7 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *P
 	if _, found := GetProvisionerInstance().Function(request.Cluster); found {
 		response.Success = false
 		response.Description = "a cluster with that identifier already exists"
-		provisionerThread.C6 <- response
+		provisionerThread.Send(request, &response)
 		provisionerThread.wg.Done()
 		return
 	}
@@ -324,7 +528,7 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *P
 	if err != nil {
 		response.Description = err.Error()
 		response.Success = false
-		provisionerThread.C6 <- response
+		provisionerThread.Send(request, &response)
 		provisionerThread.wg.Done()
 		return
 	}
@@ -333,7 +537,7 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *P
 	if err != nil {
 		response.Description = err.Error()
 		response.Success = false
-		provisionerThread.C6 <- response
+		provisionerThread.Send(request, &response)
 		provisionerThread.wg.Done()
 		return
 	}
@@ -351,7 +555,6 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *P
 
 	databaseRequest := DatabaseRequest{Action: DatabaseStore, Type: database.Config, Cluster: request.Cluster, Data: cluster.Config{
 		Identifier:                  request.Cluster,
-		Mode:                        cluster.DoNothing,
 		StartWithNTransformClusters: 1,
 		StartWithNLoadClusters:      1,
 		ETChannelThreshold:          1,
@@ -380,13 +583,13 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterLoad(request *P
 
 	if timeout || !databaseResponse.Success {
 		response.Success = false
-		provisionerThread.C6 <- response
+		provisionerThread.Send(request, &response)
 		provisionerThread.wg.Done()
 		return
 	}
 
 	response.Success = true
-	provisionerThread.C6 <- response
+	provisionerThread.Send(request, &response)
 
 	provisionerThread.wg.Done()
 }
@@ -401,7 +604,7 @@ func (provisionerThread *ProvisionerThread) ProcessDynamicClusterDelete(request
 		log.Printf("[provisioner] failed to un-registered cluster %s\n", request.Cluster)
 	}
 
-	provisionerThread.C6 <- ProvisionerResponse{Success: success, Nonce: request.Nonce}
+	provisionerThread.Send(request, &ProvisionerResponse{Success: success, Nonce: request.Nonce})
 
 	provisionerThread.wg.Done()
 }
@@ -414,8 +617,41 @@ func (provisionerThread *ProvisionerThread) ProcessIncomingCacheResponses(respon
 	provisionerThread.cacheResponseTable.Write(response.Nonce, response)
 }
 
+// Terminate
+// Forcefully stops every supervisor that is still active, this is used when the node has
+// waited longer than the hard-terminate-time for the supervisors to complete.
+func (provisionerThread *ProvisionerThread) Terminate() {
+
+	// nothing still queued may start once the node can no longer wait for it
+	GetProvisionerInstance().Withdraw()
+
+	for _, pair := range GetProvisionerInstance().GetRegistries() {
+		for _, supervisorInstance := range pair.Registry.GetSupervisors() {
+			if !supervisorInstance.IsActive() {
+				continue
+			}
+
+			provisionerThread.C11 <- MessengerRequest{
+				Action:  MessengerFatal,
+				Cluster: supervisorInstance.Config.Identifier,
+				Message: fmt.Sprintf("supervisor %d was terminated by the hard-terminate-time", supervisorInstance.Id),
+			}
+			supervisorInstance.Terminate()
+
+			log.Printf("%s[%s]%s Supervisor(%d) terminated by deadline\n", utils.Red, pair.Identifier, utils.Reset, supervisorInstance.Id)
+		}
+	}
+}
+
 func (provisionerThread *ProvisionerThread) Teardown() {
 	provisionerThread.accepting = false
 
+	// queued supervisors are not run while the node shuts down, only those already running are waited on
+	GetProvisionerInstance().Withdraw()
+
 	provisionerThread.wg.Wait()
+
+	if provisionerThread.journal != nil {
+		provisionerThread.journal.Close()
+	}
 }
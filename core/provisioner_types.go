@@ -1,6 +1,8 @@
 package core
 
 import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/journal"
 	"github.com/GabeCordo/etl/components/utils"
 	"sync"
 )
@@ -15,16 +17,22 @@ const (
 	ProvisionerUnMount
 	ProvisionerTeardown
 	ProvisionerLowerPing
+	ProvisionerWorkflow
 )
 
 type ProvisionerRequest struct {
-	Action     SupervisorAction `json:"Action"`
-	Nonce      uint32           `json:"Nonce"`
-	Cluster    string           `json:"cluster"`
-	Mount      bool             `json:"mount,omitempty"`
-	Config     string           `json:"config,omitempty"`
-	Path       string           `json:"path,omitempty"`
-	Parameters []string         `json:"parameters,omitempty"`
+	Action     SupervisorAction   `json:"Action"`
+	Nonce      uint32             `json:"Nonce"`
+	Cluster    string             `json:"cluster"`
+	Mount      bool               `json:"mount,omitempty"`
+	Config     string             `json:"config,omitempty"`
+	Supervisor uint64             `json:"supervisor,omitempty"`
+	Path       string             `json:"path,omitempty"`
+	Parameters cluster.Parameters `json:"parameters,omitempty"`
+	Workflow   string             `json:"workflow,omitempty"`
+	Priority   int                `json:"priority,omitempty"` // queued supervisors with a higher priority are admitted first
+	Journal    uint64             `json:"journal,omitempty"`  // the run a recovered request is journaled under
+	Origin     Module             `json:"origin"`             // the thread the response is returned to
 }
 
 type ProvisionerResponse struct {
@@ -33,6 +41,13 @@ type ProvisionerResponse struct {
 	Cluster      string `json:"cluster"`
 	Description  string `json:"description"`
 	SupervisorId uint64 `json:"supervisor-id"`
+	Run          uint64 `json:"run,omitempty"` // the workflow run that was started
+}
+
+// workflowResult is the response of a supervisor provisioned for a node of a workflow run
+type workflowResult struct {
+	node     string
+	response *cluster.Response
 }
 
 type ProvisionerThread struct {
@@ -49,9 +64,17 @@ type ProvisionerThread struct {
 
 	C11 chan<- MessengerRequest // Provisioner is sending request to the messenger
 
+	C12 <-chan ProvisionerRequest  // Provisioner is receiving requests from the scheduler
+	C13 chan<- ProvisionerResponse // Provisioner is sending responses to the scheduler
+
+	C14 <-chan ProvisionerRequest  // Provisioner is receiving requests from the trigger thread
+	C15 chan<- ProvisionerResponse // Provisioner is sending responses to the trigger thread
+
 	databaseResponseTable *utils.ResponseTable
 	cacheResponseTable    *utils.ResponseTable
 
+	journal *journal.Journal // nil if the runs are not journaled
+
 	accepting bool
 	wg        sync.WaitGroup
 }
@@ -92,6 +115,22 @@ func NewProvisioner(channels ...interface{}) (*ProvisionerThread, bool) {
 	if !ok {
 		return nil, ok
 	}
+	provisioner.C12, ok = (channels[8]).(chan ProvisionerRequest)
+	if !ok {
+		return nil, ok
+	}
+	provisioner.C13, ok = (channels[9]).(chan ProvisionerResponse)
+	if !ok {
+		return nil, ok
+	}
+	provisioner.C14, ok = (channels[10]).(chan ProvisionerRequest)
+	if !ok {
+		return nil, ok
+	}
+	provisioner.C15, ok = (channels[11]).(chan ProvisionerResponse)
+	if !ok {
+		return nil, ok
+	}
 
 	provisioner.databaseResponseTable = utils.NewResponseTable()
 	provisioner.cacheResponseTable = utils.NewResponseTable()
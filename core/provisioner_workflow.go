@@ -0,0 +1,92 @@
+package core
+
+import (
+	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/utils"
+	"github.com/GabeCordo/etl/components/workflow"
+	"log"
+)
+
+var workflowInstance *workflow.Store
+
+func GetWorkflowInstance() *workflow.Store {
+
+	if workflowInstance == nil {
+		workflowInstance = workflow.NewStore()
+	}
+	return workflowInstance
+}
+
+func (provisionerThread *ProvisionerThread) ProcessWorkflowRequest(request *ProvisionerRequest) {
+
+	run, success, description := GetWorkflowInstance().Start(request.Workflow, request.Parameters)
+	if !success {
+		provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: false, Description: description})
+		provisionerThread.wg.Done()
+		return
+	}
+
+	log.Printf("%s[%s]%s Workflow run(%d) started\n", utils.Green, request.Workflow, utils.Reset, run.Id())
+
+	provisionerThread.Send(request, &ProvisionerResponse{Nonce: request.Nonce, Success: true, Run: run.Id()})
+
+	go func() {
+		provisionerThread.runWorkflow(run)
+
+		status := run.Status()
+		log.Printf("%s[%s]%s Workflow run(%d) %s\n", utils.Green, status.Workflow, utils.Reset, status.Id, status.State)
+
+		// the provisioner is not torn down until every workflow run has ended
+		provisionerThread.wg.Done()
+	}()
+}
+
+// runWorkflow provisions the nodes of the run as they become ready, returning once every node has ended
+func (provisionerThread *ProvisionerThread) runWorkflow(run *workflow.Run) {
+
+	results := make(chan workflowResult)
+	running := 0
+
+	for {
+		// a node that cannot be provisioned ends straight away, which can make the nodes after it ready
+		for tasks := run.Ready(); len(tasks) > 0; tasks = run.Ready() {
+			for _, task := range tasks {
+				node := task.Node
+				request := &ProvisionerRequest{Cluster: task.Cluster, Config: task.Config, Parameters: task.Parameters}
+
+				provisionerThread.wg.Add(1)
+				supervisorInstance, description := provisionerThread.provision(request, func(response *cluster.Response) {
+					results <- workflowResult{node: node, response: response}
+				})
+				if supervisorInstance == nil {
+					provisionerThread.wg.Done()
+					run.Finished(node, false, description, nil)
+					continue
+				}
+
+				run.Started(node, supervisorInstance.Id)
+				running++
+			}
+		}
+
+		// nothing is running and nothing is ready, so every node has ended
+		if running == 0 {
+			return
+		}
+
+		result := <-results
+		running--
+
+		success, description := true, ""
+		if len(result.response.SetupError) != 0 {
+			success, description = false, "setup failed: "+result.response.SetupError
+		} else if result.response.DeadlineExceeded {
+			success, description = false, "max-runtime exceeded"
+		} else if result.response.Cancelled {
+			success, description = false, "cancelled"
+		} else if result.response.DidItCrash {
+			success, description = false, "crashed"
+		}
+		run.Finished(result.node, success, description, result.response.Outputs)
+	}
+}
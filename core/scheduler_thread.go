@@ -0,0 +1,65 @@
+package core
+
+import (
+	"github.com/GabeCordo/etl/components/scheduler"
+	"github.com/GabeCordo/etl/components/utils"
+	"log"
+	"time"
+)
+
+var schedulerInstance *scheduler.Scheduler
+
+func GetSchedulerInstance() *scheduler.Scheduler {
+	if schedulerInstance == nil {
+		schedulerInstance = scheduler.NewScheduler()
+	}
+	return schedulerInstance
+}
+
+func (schedulerThread *SchedulerThread) Setup() {
+	schedulerInstance := GetSchedulerInstance()
+
+	// schedules declared in the etl config are added on startup, any others are created over the api
+	for _, schedule := range GetConfigInstance().Schedules {
+		if success, description := schedulerInstance.Add(schedule); !success {
+			log.Printf("%s[%s]%s Could not add schedule %s; %s\n", utils.Green, schedule.Cluster, utils.Reset, schedule.Name, description)
+		}
+	}
+}
+
+func (schedulerThread *SchedulerThread) Start() {
+	go schedulerThread.drain(schedulerThread.C13)
+
+	schedulerThread.tick(DefaultSchedulerTick*time.Second, func(now time.Time) {
+		for _, fire := range GetSchedulerInstance().Due(now, isSupervisorActive) {
+			schedulerThread.wg.Add(1)
+			go schedulerThread.ProcessFire(fire)
+		}
+	})
+}
+
+// ProcessFire provisions the cluster of a schedule that is due and records the supervisor it started
+func (schedulerThread *SchedulerThread) ProcessFire(fire scheduler.Fire) {
+	defer schedulerThread.wg.Done()
+
+	supervisorId, success, description := SupervisorProvision(schedulerThread.C12, schedulerThread.provisionerResponseTable, fire.Cluster, fire.Config, fire.Parameters, fire.Priority, Scheduler)
+	GetSchedulerInstance().Fired(fire.Name, supervisorId, success, description)
+
+	if success {
+		log.Printf("%s[%s]%s Schedule %s provisioned supervisor(%d)\n", utils.Green, fire.Cluster, utils.Reset, fire.Name, supervisorId)
+	} else {
+		log.Printf("%s[%s]%s Schedule %s could not provision cluster; %s\n", utils.Green, fire.Cluster, utils.Reset, fire.Name, description)
+	}
+}
+
+// isSupervisorActive returns true if the supervisor has not yet completed, including when it is about to start
+func isSupervisorActive(clusterName string, supervisorId uint64) bool {
+	if supervisorInstance, found := SupervisorLookup(clusterName, supervisorId); found {
+		return !supervisorInstance.IsComplete()
+	}
+	return false
+}
+
+func (schedulerThread *SchedulerThread) Teardown() {
+	schedulerThread.teardown()
+}
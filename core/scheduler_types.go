@@ -0,0 +1,36 @@
+package core
+
+const (
+	DefaultSchedulerTick = 1 // seconds between checking for schedules that are due
+)
+
+type SchedulerThread struct {
+	Interrupt chan<- InterruptEvent // Upon completion or failure an interrupt can be raised
+
+	C12 chan<- ProvisionerRequest  // Scheduler is sending requests to the provisioner
+	C13 <-chan ProvisionerResponse // Scheduler is receiving responses from the provisioner
+
+	tickingThread
+}
+
+func NewSchedulerThread(channels ...any) (*SchedulerThread, bool) {
+	scheduler := new(SchedulerThread)
+	var ok bool
+
+	scheduler.Interrupt, ok = (channels[0]).(chan InterruptEvent)
+	if !ok {
+		return nil, ok
+	}
+	scheduler.C12, ok = (channels[1]).(chan ProvisionerRequest)
+	if !ok {
+		return nil, ok
+	}
+	scheduler.C13, ok = (channels[2]).(chan ProvisionerResponse)
+	if !ok {
+		return nil, ok
+	}
+
+	scheduler.init()
+
+	return scheduler, ok
+}
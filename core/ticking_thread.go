@@ -0,0 +1,59 @@
+package core
+
+import (
+	"github.com/GabeCordo/etl/components/utils"
+	"sync"
+	"time"
+)
+
+// tickingThread
+// The state shared by the threads that provision clusters on a tick, such as the scheduler and
+// trigger threads. The goroutines a tick starts to provision a cluster are added to the wait
+// group, and are waited on when the thread tears down.
+type tickingThread struct {
+	provisionerResponseTable *utils.ResponseTable
+
+	done chan struct{} // closed on teardown
+	wg   sync.WaitGroup
+}
+
+func (thread *tickingThread) init() {
+	thread.provisionerResponseTable = utils.NewResponseTable()
+	thread.done = make(chan struct{})
+}
+
+// drain
+// Writes the replies of the provisioner to the response table until the channel is closed, so the
+// provisioner is never left blocked sending one. Replies that arrive after teardown are dropped.
+func (thread *tickingThread) drain(responses <-chan ProvisionerResponse) {
+	for response := range responses {
+		select {
+		case <-thread.done:
+			// nothing waits on a reply once the thread has torn down
+		default:
+			thread.provisionerResponseTable.Write(response.Nonce, response)
+		}
+	}
+}
+
+// tick calls onTick every interval until the thread tears down
+func (thread *tickingThread) tick(interval time.Duration, onTick func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			onTick(now)
+		case <-thread.done:
+			return
+		}
+	}
+}
+
+// teardown stops the ticks and waits for every cluster being provisioned to get a reply
+func (thread *tickingThread) teardown() {
+	close(thread.done)
+
+	thread.wg.Wait()
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"github.com/GabeCordo/etl/components/cluster"
+	"github.com/GabeCordo/etl/components/supervisor"
+	"github.com/GabeCordo/etl/components/trigger"
+	"github.com/GabeCordo/etl/components/utils"
+	"log"
+	"time"
+)
+
+var triggerInstance *trigger.Watcher
+
+func GetTriggerInstance() *trigger.Watcher {
+	if triggerInstance == nil {
+		triggerInstance = trigger.NewWatcher()
+	}
+	return triggerInstance
+}
+
+func (triggerThread *TriggerThread) Setup() {
+	triggerInstance := GetTriggerInstance()
+
+	// triggers declared in the etl config are added on startup, any others are created over the api
+	for _, definition := range GetConfigInstance().Triggers {
+		if success, description := triggerInstance.Add(definition); !success {
+			log.Printf("%s[%s]%s Could not add trigger %s; %s\n", utils.Green, definition.Cluster, utils.Reset, definition.Name, description)
+		}
+	}
+}
+
+func (triggerThread *TriggerThread) Start() {
+	go triggerThread.drain(triggerThread.C15)
+
+	triggerThread.tick(DefaultTriggerTick*time.Second, func(now time.Time) {
+		// files are archived once the runs provisioned for them complete
+		for _, flight := range GetTriggerInstance().Flights() {
+			triggerThread.ProcessFlight(flight)
+		}
+		for _, arrival := range GetTriggerInstance().Scan(now) {
+			triggerThread.wg.Add(1)
+			go triggerThread.ProcessArrival(arrival)
+		}
+	})
+}
+
+// ProcessArrival provisions the cluster of a trigger with the path of the file that arrived
+func (triggerThread *TriggerThread) ProcessArrival(arrival trigger.Arrival) {
+	defer triggerThread.wg.Done()
+
+	parameters := make(cluster.Parameters)
+	for name, value := range arrival.Parameters {
+		parameters[name] = value
+	}
+	parameters[arrival.Parameter] = arrival.Path
+
+	supervisorId, success, description := SupervisorProvision(triggerThread.C14, triggerThread.provisionerResponseTable, arrival.Cluster, arrival.Config, parameters, arrival.Priority, Trigger)
+	GetTriggerInstance().Provisioned(arrival.Name, arrival.Path, supervisorId, success, description)
+
+	if success {
+		log.Printf("%s[%s]%s Trigger %s provisioned supervisor(%d) for %s\n", utils.Green, arrival.Cluster, utils.Reset, arrival.Name, supervisorId, arrival.Path)
+	} else {
+		log.Printf("%s[%s]%s Trigger %s could not provision cluster for %s; %s\n", utils.Green, arrival.Cluster, utils.Reset, arrival.Name, arrival.Path, description)
+	}
+}
+
+// ProcessFlight archives the file once the supervisor provisioned for it has completed
+func (triggerThread *TriggerThread) ProcessFlight(flight trigger.Flight) {
+	supervisorInstance, found := SupervisorLookup(flight.Cluster, flight.Supervisor)
+	if !found {
+		GetTriggerInstance().Completed(flight.Trigger, flight.Path, false, fmt.Sprintf("supervisor %d not found", flight.Supervisor))
+		return
+	}
+	if !supervisorInstance.IsComplete() {
+		return
+	}
+
+	// a supervisor that crashed without being restarted, or failed to set up, finishes in a failed state
+	switch supervisorInstance.State {
+	case supervisor.Terminated:
+		GetTriggerInstance().Completed(flight.Trigger, flight.Path, true, "")
+	case supervisor.Cancelled:
+		if supervisorInstance.DeadlineExceeded() {
+			GetTriggerInstance().Completed(flight.Trigger, flight.Path, false, fmt.Sprintf("supervisor %d exceeded its max-runtime", flight.Supervisor))
+			break
+		}
+		GetTriggerInstance().Completed(flight.Trigger, flight.Path, false, fmt.Sprintf("supervisor %d was cancelled", flight.Supervisor))
+	default:
+		GetTriggerInstance().Completed(flight.Trigger, flight.Path, false, fmt.Sprintf("supervisor %d failed", flight.Supervisor))
+	}
+}
+
+func (triggerThread *TriggerThread) Teardown() {
+	triggerThread.teardown()
+}
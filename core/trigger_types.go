@@ -0,0 +1,36 @@
+package core
+
+const (
+	DefaultTriggerTick = 1 // seconds between scans of the watched directories
+)
+
+type TriggerThread struct {
+	Interrupt chan<- InterruptEvent // Upon completion or failure an interrupt can be raised
+
+	C14 chan<- ProvisionerRequest  // Trigger is sending requests to the provisioner
+	C15 <-chan ProvisionerResponse // Trigger is receiving responses from the provisioner
+
+	tickingThread
+}
+
+func NewTriggerThread(channels ...any) (*TriggerThread, bool) {
+	trigger := new(TriggerThread)
+	var ok bool
+
+	trigger.Interrupt, ok = (channels[0]).(chan InterruptEvent)
+	if !ok {
+		return nil, ok
+	}
+	trigger.C14, ok = (channels[1]).(chan ProvisionerRequest)
+	if !ok {
+		return nil, ok
+	}
+	trigger.C15, ok = (channels[2]).(chan ProvisionerResponse)
+	if !ok {
+		return nil, ok
+	}
+
+	trigger.init()
+
+	return trigger, ok
+}